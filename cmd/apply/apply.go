@@ -0,0 +1,20 @@
+package apply
+
+import (
+	"github.com/run-ai/runai-cli/cmd/noderole"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "apply",
+		Short: "Apply resources from files.",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.HelpFunc()(cmd, args)
+		},
+	}
+
+	command.AddCommand(noderole.Apply())
+
+	return command
+}
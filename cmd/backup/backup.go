@@ -0,0 +1,206 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	"github.com/run-ai/runai-cli/pkg/kube"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	resourcesFileName = "resources.yaml"
+	databaseFileName  = "runai-db.sql"
+
+	runaiDbPod       = "runai-db-0"
+	runaiDbContainer = "runai-db"
+)
+
+var (
+	dumpDatabaseCommand    = []string{"sh", "-c", `pg_dumpall --clean --if-exists -U "${POSTGRES_USER:-postgres}"`}
+	restoreDatabaseCommand = []string{"sh", "-c", `psql -U "${POSTGRES_USER:-postgres}" -d postgres`}
+)
+
+type backupSource struct {
+	resource      string
+	namespace     string
+	labelSelector string
+}
+
+// the Run:AI state that cannot be recreated by the operator
+var backupSources = []backupSource{
+	{resource: "runaiconfigs.run.ai", namespace: common.RunaiNamespace},
+	{resource: "projects.run.ai"},
+	{resource: "departments"},
+	{resource: "configmaps", namespace: common.RunaiNamespace, labelSelector: common.TemplateConfigMapLabel},
+	{resource: "configmaps", namespace: common.RunaiNamespace, labelSelector: common.ClusterConfigMapLabel},
+	{resource: "secrets", namespace: common.RunaiNamespace, labelSelector: common.ClusterWideSecretLabel},
+}
+
+// server maintained fields that must not be re-applied on restore
+var strippedFields = [][]string{
+	{"metadata", "uid"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "generation"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "selfLink"},
+	{"metadata", "managedFields"},
+	{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"},
+	{"status"},
+}
+
+// Create exports the Run:AI state to a .tar.gz archive in dir and returns the archive path.
+// When withDatabase is set, the runai-db contents are dumped through the pods/exec API as well.
+// A resource type that is not installed is skipped, any other failure to list a resource fails the backup.
+// The archive has the cluster-wide Run:AI secrets and the database in plain text, so it is created with mode 0600.
+func Create(client *client.Client, dir string, withDatabase bool) (string, error) {
+	var resources bytes.Buffer
+	count := 0
+	for _, source := range backupSources {
+		objects, err := kube.List(client, source.resource, source.namespace, source.labelSelector)
+		if meta.IsNoMatchError(err) || apierrors.IsNotFound(err) {
+			log.Infof("Skipping backup of %s, it is not installed", source.resource)
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to list %s: %v", source.resource, err)
+		}
+		for i := range objects {
+			data, err := marshalForBackup(&objects[i].Unstructured)
+			if err != nil {
+				return "", err
+			}
+			resources.WriteString("---\n")
+			resources.Write(data)
+			count++
+		}
+	}
+
+	files := map[string][]byte{resourcesFileName: resources.Bytes()}
+	if withDatabase {
+		var dump, stderr bytes.Buffer
+		err := kube.Exec(client, common.RunaiNamespace, runaiDbPod, runaiDbContainer, dumpDatabaseCommand, nil, &dump, &stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to dump runai-db: %v %s", err, stderr.String())
+		}
+		files[databaseFileName] = dump.Bytes()
+	}
+
+	archivePath := path.Join(dir, fmt.Sprintf("runai-backup-%s.tar.gz", time.Now().UTC().Format("20060102-150405")))
+	if err := writeArchive(archivePath, files); err != nil {
+		return "", err
+	}
+	log.Infof("Backed up %d resources to %s", count, archivePath)
+	return archivePath, nil
+}
+
+// Restore re-applies the resources of a backup archive and, when withDatabase is set, restores the runai-db dump
+func Restore(client *client.Client, archivePath string, withDatabase bool) error {
+	files, err := readArchive(archivePath)
+	if err != nil {
+		return err
+	}
+
+	if resources, found := files[resourcesFileName]; found {
+		objects, err := kube.ParseManifests(resources)
+		if err != nil {
+			return err
+		}
+		if err := kube.Apply(client, objects); err != nil {
+			return fmt.Errorf("failed to restore resources: %v", err)
+		}
+		log.Infof("Restored %d resources", len(objects))
+	}
+
+	if !withDatabase {
+		return nil
+	}
+	dump, found := files[databaseFileName]
+	if !found {
+		return fmt.Errorf("archive %s does not contain a runai-db dump", archivePath)
+	}
+	var stderr bytes.Buffer
+	err = kube.Exec(client, common.RunaiNamespace, runaiDbPod, runaiDbContainer, restoreDatabaseCommand, bytes.NewReader(dump), ioutil.Discard, &stderr)
+	if err != nil {
+		return fmt.Errorf("failed to restore runai-db: %v %s", err, stderr.String())
+	}
+	log.Infof("Restored runai-db")
+	return nil
+}
+
+func marshalForBackup(obj *unstructured.Unstructured) ([]byte, error) {
+	obj = obj.DeepCopy()
+	for _, field := range strippedFields {
+		unstructured.RemoveNestedField(obj.Object, field...)
+	}
+	return yaml.Marshal(obj.Object)
+}
+
+// writeArchive creates the archive readable only by the user, as it has the Run:AI secrets and the runai-db dump.
+// An existing file is never overwritten.
+func writeArchive(archivePath string, files map[string][]byte) error {
+	out, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, data := range files {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tarWriter.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func readArchive(archivePath string) (map[string][]byte, error) {
+	in, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	gzipReader, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %v", archivePath, err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+	files := map[string][]byte{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive %s: %v", archivePath, err)
+		}
+		data, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+		files[header.Name] = data
+	}
+	return files, nil
+}
@@ -2,11 +2,13 @@ package common
 
 import (
 	"os"
+	"os/user"
 
 	"github.com/run-ai/runai-cli/pkg/client"
 	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 const (
@@ -15,17 +17,36 @@ const (
 	RunaiBackendNamespace              = "runai-backend"
 	RunaiOperatorDeploymentName        = "runai-operator"
 	RunaiBackendOperatorDeploymentName = "helm-operator"
+	RunaiConfigName                    = "runai"
+	RunaiConfigCrdName                 = "runaiconfigs.run.ai"
+	ClusterWideSecretLabel             = "runai/cluster-wide"
+	TemplateConfigMapLabel             = "runai/template"
+	ClusterConfigMapLabel              = "runai/cluster-config"
 )
 
+var RunaiConfigResource = schema.GroupVersionResource{Group: "run.ai", Version: "v1", Resource: "runaiconfigs"}
+
 func ScaleRunaiOperator(client *client.Client, replicas int32) {
-	scaleDeployment(client, RunaiNamespace, RunaiOperatorDeploymentName, replicas)
+	ScaleDeployment(client, RunaiNamespace, RunaiOperatorDeploymentName, replicas)
 }
 
 func ScaleRunaiBackendOperator(client *client.Client, replicas int32) {
-	scaleDeployment(client, RunaiBackendNamespace, RunaiBackendOperatorDeploymentName, replicas)
+	ScaleDeployment(client, RunaiBackendNamespace, RunaiBackendOperatorDeploymentName, replicas)
+}
+
+// GetDeploymentReplicas returns the number of replicas a deployment is scaled to
+func GetDeploymentReplicas(client *client.Client, namespace, deploymentName string) (int32, error) {
+	deployment, err := client.GetClientset().AppsV1().Deployments(namespace).Get(deploymentName, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	if deployment.Spec.Replicas == nil {
+		return 1, nil
+	}
+	return *deployment.Spec.Replicas, nil
 }
 
-func scaleDeployment(client *client.Client, namespace, deploymentName string, replicas int32) {
+func ScaleDeployment(client *client.Client, namespace, deploymentName string, replicas int32) {
 	var err error
 	var deployment *appsv1.Deployment
 	for i := 0; i < NumberOfRetiresForApiServer; i++ {
@@ -48,3 +69,16 @@ func scaleDeployment(client *client.Client, namespace, deploymentName string, re
 	}
 	log.Infof("Scaled %s to: %v", deploymentName, replicas)
 }
+
+// AdminIdentity identifies the admin running runai-adm, as user@hostname
+func AdminIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	username := "unknown"
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+	return username + "@" + hostname
+}
@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"github.com/run-ai/runai-cli/cmd/noderole"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "controller",
+		Short: "Run controllers.",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.HelpFunc()(cmd, args)
+		},
+	}
+
+	command.AddCommand(noderole.Controller())
+
+	return command
+}
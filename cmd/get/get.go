@@ -15,6 +15,7 @@
 package get
 
 import (
+	"github.com/run-ai/runai-cli/cmd/noderole"
 	"github.com/run-ai/runai-cli/cmd/version"
 	"github.com/spf13/cobra"
 )
@@ -29,6 +30,8 @@ func Command() *cobra.Command {
 	}
 
 	command.AddCommand(version.GetVersion())
+	command.AddCommand(noderole.Get())
+	command.AddCommand(noderole.GetNodePools())
 
 	return command
 }
@@ -0,0 +1,237 @@
+package health
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	DefaultTimeout = 10 * time.Minute
+
+	pollInterval = 5 * time.Second
+)
+
+type componentStatus struct {
+	name    string
+	ready   bool
+	message string
+}
+
+// WaitForReady waits until the Run:AI operator, the RunaiConfig and all the workloads in the runai namespace are available.
+// A table of the components is printed every time their state changes. On timeout, the returned error names the components
+// that are still not ready.
+func WaitForReady(client *client.Client, timeout time.Duration) error {
+	log.Infof("Waiting up to %v for the Run:AI components to become ready", timeout)
+	deadline := time.Now().Add(timeout)
+	lastTable := ""
+	for {
+		statuses := getComponentStatuses(client)
+		table := formatStatuses(statuses)
+		if table != lastTable {
+			fmt.Print(table)
+			lastTable = table
+		}
+
+		notReady := notReadyComponents(statuses)
+		if len(notReady) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v, components not ready: %s", timeout, strings.Join(notReady, ", "))
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func notReadyComponents(statuses []componentStatus) []string {
+	var notReady []string
+	for _, status := range statuses {
+		if !status.ready {
+			notReady = append(notReady, status.name)
+		}
+	}
+	return notReady
+}
+
+func formatStatuses(statuses []componentStatus) string {
+	var builder strings.Builder
+	w := tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\nCOMPONENT\tREADY\tMESSAGE\n")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "%s\t%v\t%s\n", status.name, status.ready, status.message)
+	}
+	w.Flush()
+	return builder.String()
+}
+
+func getComponentStatuses(client *client.Client) []componentStatus {
+	statuses := []componentStatus{
+		getOperatorStatus(client),
+		getRunaiConfigStatus(client),
+	}
+	return append(statuses, getWorkloadStatuses(client)...)
+}
+
+func getOperatorStatus(client *client.Client) componentStatus {
+	name := "deployment/" + common.RunaiOperatorDeploymentName
+	deployment, err := client.GetClientset().AppsV1().Deployments(common.RunaiNamespace).Get(common.RunaiOperatorDeploymentName, metav1.GetOptions{})
+	if err != nil {
+		return componentStatus{name: name, message: err.Error()}
+	}
+	return deploymentStatus(*deployment)
+}
+
+func getRunaiConfigStatus(client *client.Client) componentStatus {
+	name := "runaiconfig/" + common.RunaiConfigName
+	runaiConfig, err := client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Get(common.RunaiConfigName, metav1.GetOptions{})
+	if err != nil {
+		return componentStatus{name: name, message: err.Error()}
+	}
+
+	// the conditions are of the generation the operator observed, which is older right after the RunaiConfig changed.
+	// Operators that do not publish the observed generation are trusted by their conditions alone.
+	observedGeneration, found, _ := unstructured.NestedInt64(runaiConfig.Object, "status", "observedGeneration")
+	if found && observedGeneration < runaiConfig.GetGeneration() {
+		return componentStatus{name: name, message: fmt.Sprintf("waiting for generation %d to be observed, observed %d", runaiConfig.GetGeneration(), observedGeneration)}
+	}
+	conditions, found, _ := unstructured.NestedSlice(runaiConfig.Object, "status", "conditions")
+	if !found || len(conditions) == 0 {
+		return componentStatus{name: name, message: "not reconciled yet"}
+	}
+	// the condition types are those of the operator-sdk operators: Deployed, ReleaseFailed and Irreconcilable of the
+	// Helm operator, Successful and Failure of the Ansible operator, and the common Available, Ready and Degraded
+	ready := false
+	var messages []string
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		conditionType := fmt.Sprint(conditionMap["type"])
+		isTrue := fmt.Sprint(conditionMap["status"]) == "True"
+		switch conditionType {
+		case "Available", "Ready", "Successful", "Deployed":
+			ready = ready || isTrue
+		case "Failure", "Degraded", "ReleaseFailed", "Irreconcilable":
+			if isTrue {
+				messages = append(messages, fmt.Sprintf("%s: %v", conditionType, conditionMap["message"]))
+			}
+		}
+	}
+	if len(messages) > 0 {
+		return componentStatus{name: name, message: strings.Join(messages, "; ")}
+	}
+	if !ready {
+		return componentStatus{name: name, message: "reconciling"}
+	}
+	return componentStatus{name: name, ready: true}
+}
+
+func getWorkloadStatuses(client *client.Client) []componentStatus {
+	var statuses []componentStatus
+	deployments, err := client.GetClientset().AppsV1().Deployments(common.RunaiNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return []componentStatus{{name: "deployments", message: err.Error()}}
+	}
+	for _, deployment := range deployments.Items {
+		if deployment.Name == common.RunaiOperatorDeploymentName {
+			continue
+		}
+		statuses = append(statuses, deploymentStatus(deployment))
+	}
+
+	daemonSets, err := client.GetClientset().AppsV1().DaemonSets(common.RunaiNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return append(statuses, componentStatus{name: "daemonsets", message: err.Error()})
+	}
+	for _, daemonSet := range daemonSets.Items {
+		statuses = append(statuses, daemonSetStatus(daemonSet))
+	}
+
+	statefulSets, err := client.GetClientset().AppsV1().StatefulSets(common.RunaiNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return append(statuses, componentStatus{name: "statefulsets", message: err.Error()})
+	}
+	for _, statefulSet := range statefulSets.Items {
+		statuses = append(statuses, statefulSetStatus(statefulSet))
+	}
+
+	if len(statuses) == 0 {
+		return []componentStatus{{name: "workloads", message: "no components created yet"}}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].name < statuses[j].name
+	})
+	return statuses
+}
+
+func deploymentStatus(deployment appsv1.Deployment) componentStatus {
+	status := componentStatus{name: "deployment/" + deployment.Name}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	switch {
+	case deployment.Status.ObservedGeneration < deployment.Generation:
+		status.message = "waiting for the rollout to be observed"
+	case deployment.Status.UpdatedReplicas < replicas:
+		status.message = fmt.Sprintf("%d of %d replicas updated", deployment.Status.UpdatedReplicas, replicas)
+	case deployment.Status.AvailableReplicas < replicas:
+		status.message = fmt.Sprintf("%d of %d replicas available", deployment.Status.AvailableReplicas, replicas)
+	default:
+		status.ready = true
+	}
+	return status
+}
+
+func daemonSetStatus(daemonSet appsv1.DaemonSet) componentStatus {
+	status := componentStatus{name: "daemonset/" + daemonSet.Name}
+	desired := daemonSet.Status.DesiredNumberScheduled
+	switch {
+	case daemonSet.Status.ObservedGeneration < daemonSet.Generation:
+		status.message = "waiting for the rollout to be observed"
+	case daemonSet.Status.UpdatedNumberScheduled < desired:
+		status.message = fmt.Sprintf("%d of %d pods updated", daemonSet.Status.UpdatedNumberScheduled, desired)
+	case daemonSet.Status.NumberAvailable < desired:
+		status.message = fmt.Sprintf("%d of %d pods available", daemonSet.Status.NumberAvailable, desired)
+	default:
+		status.ready = true
+	}
+	return status
+}
+
+func statefulSetStatus(statefulSet appsv1.StatefulSet) componentStatus {
+	status := componentStatus{name: "statefulset/" + statefulSet.Name}
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	switch {
+	case statefulSet.Status.ObservedGeneration < statefulSet.Generation:
+		status.message = "waiting for the rollout to be observed"
+	case statefulSet.Status.ReadyReplicas < replicas:
+		status.message = fmt.Sprintf("%d of %d replicas ready", statefulSet.Status.ReadyReplicas, replicas)
+	default:
+		status.ready = true
+	}
+	return status
+}
+
+// ExitIfNotReady waits for the components and exits with a non-zero code when they are not ready in time
+func ExitIfNotReady(client *client.Client, timeout time.Duration) {
+	if err := WaitForReady(client, timeout); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+}
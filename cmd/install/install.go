@@ -16,22 +16,33 @@ package install
 
 import (
 	"fmt"
+	"os"
+	"time"
 
-	"github.com/run-ai/runai-cli/pkg/util/kubectl"
+	"github.com/run-ai/runai-cli/cmd/health"
+	"github.com/run-ai/runai-cli/cmd/lock"
+	"github.com/run-ai/runai-cli/cmd/preflight"
+	"github.com/run-ai/runai-cli/pkg/client"
+	"github.com/run-ai/runai-cli/pkg/kube"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 type upgradeFlags struct {
-	filePath string
+	filePath      string
+	skipPreflight bool
+	wait          bool
+	timeout       time.Duration
+	dryRun        bool
 }
 
 func Command() *cobra.Command {
 	upgradeFlags := upgradeFlags{}
 	var command = &cobra.Command{
-		Use:   "install",
-		Short: "Install a Run:AI cluster.",
-		Args:  cobra.ExactArgs(0),
+		Use:         "install",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Short:       "Install a Run:AI cluster.",
+		Args:        cobra.ExactArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
 			if cmd.Flags().NFlag() == 0 {
 				fmt.Println("No flags were provided")
@@ -39,9 +50,32 @@ func Command() *cobra.Command {
 				return
 			}
 
+			client := client.GetClient()
+			if !upgradeFlags.skipPreflight {
+				if err := preflight.Run(client); err != nil && !upgradeFlags.dryRun {
+					log.Errorf("%v, use --skip-preflight to install anyway", err)
+					os.Exit(1)
+				}
+			}
+
+			if upgradeFlags.dryRun {
+				objects, err := kube.ReadManifestFile(upgradeFlags.filePath)
+				if err != nil {
+					log.Error(err)
+					os.Exit(1)
+				}
+				kube.PrintDiffs(os.Stdout, fmt.Sprintf("Configuration file %s", upgradeFlags.filePath), kube.Diff(client, objects))
+				return
+			}
+
 			log.Infof("Installing from file: %v", upgradeFlags.filePath)
-			for i := 0; i < 2; i++ {
-				kubectl.Apply(upgradeFlags.filePath) // need to remove the crds from this file
+			if err := kube.ApplyFile(client, upgradeFlags.filePath); err != nil {
+				log.Errorf("Failed to install Run:AI Cluster, error: %v", err)
+				os.Exit(1)
+			}
+
+			if upgradeFlags.wait {
+				health.ExitIfNotReady(client, upgradeFlags.timeout)
 			}
 
 			log.Println("Successfully installed Run:AI Cluster")
@@ -49,6 +83,10 @@ func Command() *cobra.Command {
 	}
 
 	command.Flags().StringVarP(&upgradeFlags.filePath, "file", "f", "", "path of runai config .yaml file")
+	command.Flags().BoolVar(&upgradeFlags.skipPreflight, "skip-preflight", false, "Skip the pre-flight checks")
+	command.Flags().BoolVar(&upgradeFlags.wait, "wait", false, "Wait until all Run:AI components are ready")
+	command.Flags().DurationVar(&upgradeFlags.timeout, "timeout", health.DefaultTimeout, "Time to wait for the Run:AI components when using --wait")
+	command.Flags().BoolVar(&upgradeFlags.dryRun, "dry-run", false, "Print the changes the install would make without applying them")
 
 	return command
 }
@@ -0,0 +1,138 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Revert reverts the recorded changes of an interrupted run in reverse order, scales the deployments it scaled down back
+// to their recorded replicas and deletes the journal. The journal is kept when any of the changes cannot be reverted.
+// Resources that the run deleted are not restored, the Run:AI operator recreates them.
+func Revert(client *client.Client, j *Journal) error {
+	var errs []error
+	for i := len(j.Undo) - 1; i >= 0; i-- {
+		record := j.Undo[i]
+		if err := undo(client, record); err != nil {
+			errs = append(errs, fmt.Errorf("failed to revert %s %s: %v", record.Kind, record.Name, err))
+			continue
+		}
+		log.Infof("Reverted %s %s", record.Kind, record.Name)
+	}
+
+	for key, replicas := range j.Replicas {
+		parts := strings.SplitN(key, "/", 2)
+		common.ScaleDeployment(client, parts[0], parts[1], replicas)
+	}
+
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	j.client = client
+	j.Finish()
+	return nil
+}
+
+func undo(client *client.Client, record UndoRecord) error {
+	switch record.Kind {
+	case undoNodeLabels:
+		return undoLabels(client, record)
+	case undoNodeTaints:
+		return undoTaints(client, record)
+	case undoDeploymentTemplate:
+		return undoTemplate(client, record)
+	case undoObjectSpec:
+		return undoSpec(client, record)
+	default:
+		return fmt.Errorf("unknown change kind %s", record.Kind)
+	}
+}
+
+func undoLabels(client *client.Client, record UndoRecord) error {
+	var labels map[string]*string
+	if err := json.Unmarshal(record.Data, &labels); err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"labels": labels}})
+	if err != nil {
+		return err
+	}
+	_, err = client.GetClientset().CoreV1().Nodes().Patch(record.Name, types.MergePatchType, patch)
+	return err
+}
+
+func undoTaints(client *client.Client, record UndoRecord) error {
+	var taints []v1.Taint
+	if err := json.Unmarshal(record.Data, &taints); err != nil {
+		return err
+	}
+	var err error
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		node, getErr := client.GetClientset().CoreV1().Nodes().Get(record.Name, metav1.GetOptions{})
+		if getErr != nil {
+			return getErr
+		}
+		node.Spec.Taints = taints
+		_, err = client.GetClientset().CoreV1().Nodes().Update(node)
+		if err == nil {
+			return nil
+		}
+		log.Debugf("Failed to update %s, attempt: %v, error: %v", record.Name, i, err)
+	}
+	return err
+}
+
+func undoTemplate(client *client.Client, record UndoRecord) error {
+	var template v1.PodTemplateSpec
+	if err := json.Unmarshal(record.Data, &template); err != nil {
+		return err
+	}
+	var err error
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		deployment, getErr := client.GetClientset().AppsV1().Deployments(record.Namespace).Get(record.Name, metav1.GetOptions{})
+		if getErr != nil {
+			return getErr
+		}
+		deployment.Spec.Template = template
+		_, err = client.GetClientset().AppsV1().Deployments(record.Namespace).Update(deployment)
+		if err == nil {
+			return nil
+		}
+		log.Debugf("Failed to update %s, attempt: %v, error: %v", record.Name, i, err)
+	}
+	return err
+}
+
+func undoSpec(client *client.Client, record UndoRecord) error {
+	var spec map[string]interface{}
+	if err := json.Unmarshal(record.Data, &spec); err != nil {
+		return err
+	}
+	resource := client.GetDynamicClient().Resource(schema.GroupVersionResource{Group: record.Group, Version: record.Version, Resource: record.Resource}).Namespace(record.Namespace)
+	var err error
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		obj, getErr := resource.Get(record.Name, metav1.GetOptions{})
+		if getErr != nil {
+			return getErr
+		}
+		if err := unstructured.SetNestedMap(obj.Object, spec, "spec"); err != nil {
+			return err
+		}
+		_, err = resource.Update(obj, metav1.UpdateOptions{})
+		if err == nil {
+			return nil
+		}
+		log.Debugf("Failed to update %s, attempt: %v, error: %v", record.Name, i, err)
+	}
+	return err
+}
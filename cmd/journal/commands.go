@@ -0,0 +1,83 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/run-ai/runai-cli/cmd/lock"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func Resume() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "resume",
+		Short: "Resume an interrupted node-role or upgrade run",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			j, err := Get(client.GetClient())
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			if j == nil {
+				log.Info("No interrupted run was found")
+				return
+			}
+			printJournal(j)
+
+			SetResuming()
+			root := cmd.Root()
+			root.SetArgs(j.Args)
+			if err := root.Execute(); err != nil {
+				os.Exit(1)
+			}
+		},
+	}
+
+	return command
+}
+
+func Abort() *cobra.Command {
+	var command = &cobra.Command{
+		Use:         "abort",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Short:       "Revert the changes of an interrupted node-role or upgrade run and restore the scaled down operators",
+		Args:        cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := client.GetClient()
+			j, err := Get(client)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			if j == nil {
+				log.Info("No interrupted run was found")
+				return
+			}
+			printJournal(j)
+
+			if err := Revert(client, j); err != nil {
+				log.Errorf("Failed to abort '%s', run abort again after fixing the errors: %v", j.Command, err)
+				os.Exit(1)
+			}
+			log.Infof("Aborted '%s'", j.Command)
+		},
+	}
+
+	return command
+}
+
+func printJournal(j *Journal) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Interrupted run:\t%s\n", strings.Join(j.Args, " "))
+	fmt.Fprintf(w, "Started:\t%s by %s\n", j.StartTime.Format(time.RFC3339), j.Holder)
+	fmt.Fprintf(w, "Completed steps:\t%s\n", strings.Join(j.CompletedSteps, ", "))
+	fmt.Fprintf(w, "Recorded changes:\t%d\n", len(j.Undo))
+	w.Flush()
+	fmt.Println()
+}
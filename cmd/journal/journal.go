@@ -0,0 +1,345 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	configMapName = "runai-adm-journal"
+	journalKey    = "journal"
+
+	undoNodeLabels         = "node-labels"
+	undoNodeTaints         = "node-taints"
+	undoDeploymentTemplate = "deployment-template"
+	undoObjectSpec         = "object-spec"
+)
+
+var (
+	resuming bool
+	// active is the journal of the running command, until it is finished
+	active *Journal
+)
+
+// UndoRecord holds the state of an object before a journaled run changed it
+type UndoRecord struct {
+	Kind      string          `json:"kind"`
+	Group     string          `json:"group,omitempty"`
+	Version   string          `json:"version,omitempty"`
+	Resource  string          `json:"resource,omitempty"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Journal records the progress of a multi-step command in a ConfigMap in the runai namespace, so that an interrupted
+// run is detected by the next one and can be resumed or aborted. A nil Journal runs the steps without recording them.
+type Journal struct {
+	Command        string            `json:"command"`
+	Args           []string          `json:"args"`
+	Holder         string            `json:"holder"`
+	StartTime      time.Time         `json:"startTime"`
+	Replicas       map[string]int32  `json:"replicas,omitempty"`
+	CompletedSteps []string          `json:"completedSteps,omitempty"`
+	Values         map[string]string `json:"values,omitempty"`
+	Undo           []UndoRecord      `json:"undo,omitempty"`
+
+	client *client.Client
+}
+
+// SetResuming makes Begin continue the interrupted journal of the same command instead of refusing to start
+func SetResuming() {
+	resuming = true
+}
+
+func IsResuming() bool {
+	return resuming
+}
+
+// Begin starts the journal of a command. It fails when the journal of an interrupted run exists, unless the run
+// is being resumed.
+func Begin(client *client.Client, command string) (*Journal, error) {
+	existing, err := Get(client)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if resuming && existing.Command == command {
+			log.Infof("Resuming '%s' started at %s by %s", existing.Command, existing.StartTime.Format(time.RFC3339), existing.Holder)
+			active = existing
+			watchInterrupts(existing)
+			return existing, nil
+		}
+		return nil, fmt.Errorf("an interrupted '%s' started at %s by %s was found, run 'runai-adm resume' to continue it or 'runai-adm abort' to revert it",
+			existing.Command, existing.StartTime.Format(time.RFC3339), existing.Holder)
+	}
+
+	j := &Journal{
+		Command:   command,
+		Args:      os.Args[1:],
+		Holder:    common.AdminIdentity(),
+		StartTime: time.Now().UTC(),
+		client:    client,
+	}
+	if err := j.save(); err != nil {
+		return nil, fmt.Errorf("failed to create the journal: %v", err)
+	}
+	active = j
+	watchInterrupts(j)
+	return j, nil
+}
+
+// Get returns the journal of an interrupted run, or nil when there is none
+func Get(client *client.Client) (*Journal, error) {
+	configMap, err := client.GetClientset().CoreV1().ConfigMaps(common.RunaiNamespace).Get(configMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the journal: %v", err)
+	}
+	j := &Journal{client: client}
+	if err := json.Unmarshal([]byte(configMap.Data[journalKey]), j); err != nil {
+		return nil, fmt.Errorf("failed to parse the journal %s/%s: %v", common.RunaiNamespace, configMapName, err)
+	}
+	return j, nil
+}
+
+// watchInterrupts tells the admin how to continue when the run is interrupted
+func watchInterrupts(j *Journal) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Errorf("'%s' was interrupted, run 'runai-adm resume' to continue it or 'runai-adm abort' to revert it", j.Command)
+		Exit()
+	}()
+}
+
+// Exit exits after a step of the running command failed. The deployments it scaled down stay scaled down until the
+// run is resumed or aborted, so they are reported.
+func Exit() {
+	if active != nil {
+		for _, key := range active.scaledDown() {
+			log.Errorf("%s is left scaled down, run 'runai-adm resume' to continue '%s' or 'runai-adm abort' to revert it", key, active.Command)
+		}
+	}
+	os.Exit(1)
+}
+
+// scaledDown returns the deployments, as namespace/name, that were scaled down and not restored yet
+func (j *Journal) scaledDown() []string {
+	var keys []string
+	for key := range j.Replicas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Step runs a step of the command unless it was completed by the interrupted run being resumed
+func (j *Journal) Step(name string, run func()) {
+	if j == nil {
+		run()
+		return
+	}
+	for _, completed := range j.CompletedSteps {
+		if completed == name {
+			log.Infof("Skipping completed step: %s", name)
+			return
+		}
+	}
+	log.Debugf("Running step: %s", name)
+	run()
+	j.CompletedSteps = append(j.CompletedSteps, name)
+	j.saveOrExit()
+}
+
+// Value returns the value recorded under key by the first run, recording the current value when there is none.
+// Resumed runs use it to decide based on the state of the cluster before it was changed.
+func (j *Journal) Value(key string, current func() (string, error)) (string, error) {
+	if j == nil {
+		return current()
+	}
+	if value, found := j.Values[key]; found {
+		return value, nil
+	}
+	value, err := current()
+	if err != nil {
+		return "", err
+	}
+	if j.Values == nil {
+		j.Values = map[string]string{}
+	}
+	j.Values[key] = value
+	return value, j.save()
+}
+
+// ScaleDown records the replicas of a deployment, including 0 for a deployment the admin stopped, and scales it to 0
+func (j *Journal) ScaleDown(client *client.Client, namespace, deploymentName string) {
+	if j != nil {
+		key := namespace + "/" + deploymentName
+		if _, found := j.Replicas[key]; !found {
+			replicas, err := common.GetDeploymentReplicas(client, namespace, deploymentName)
+			if err != nil {
+				log.Infof("Failed to get %s, error: %v", deploymentName, err)
+				Exit()
+			}
+			if j.Replicas == nil {
+				j.Replicas = map[string]int32{}
+			}
+			j.Replicas[key] = replicas
+			j.saveOrExit()
+		}
+	}
+	common.ScaleDeployment(client, namespace, deploymentName, 0)
+}
+
+// RestoreReplicas scales a deployment back to the replicas recorded by ScaleDown and drops the record, so that a
+// deployment already restored is neither scaled again nor reported as scaled down
+func (j *Journal) RestoreReplicas(client *client.Client, namespace, deploymentName string) {
+	if j == nil {
+		common.ScaleDeployment(client, namespace, deploymentName, 1)
+		return
+	}
+	key := namespace + "/" + deploymentName
+	replicas, found := j.Replicas[key]
+	if !found {
+		return
+	}
+	common.ScaleDeployment(client, namespace, deploymentName, replicas)
+	delete(j.Replicas, key)
+	j.saveOrExit()
+}
+
+// RecordNodeLabels records the values of the labels of a node before they are changed.
+// Labels that the node does not have are recorded as null.
+func (j *Journal) RecordNodeLabels(node *v1.Node, labels []string) {
+	if j == nil || j.hasUndo(undoNodeLabels, "", node.Name) {
+		return
+	}
+	values := map[string]*string{}
+	for _, label := range labels {
+		if value, found := node.Labels[label]; found {
+			values[label] = &value
+		} else {
+			values[label] = nil
+		}
+	}
+	j.addUndo(UndoRecord{Kind: undoNodeLabels, Name: node.Name}, values)
+}
+
+// RecordNodeTaints records the taints of a node before they are changed
+func (j *Journal) RecordNodeTaints(node *v1.Node) {
+	if j == nil || j.hasUndo(undoNodeTaints, "", node.Name) {
+		return
+	}
+	j.addUndo(UndoRecord{Kind: undoNodeTaints, Name: node.Name}, node.Spec.Taints)
+}
+
+// RecordDeploymentTemplate records the pod template of a deployment before it is changed
+func (j *Journal) RecordDeploymentTemplate(deployment *appsv1.Deployment) {
+	if j == nil || j.hasUndo(undoDeploymentTemplate, deployment.Namespace, deployment.Name) {
+		return
+	}
+	j.addUndo(UndoRecord{Kind: undoDeploymentTemplate, Namespace: deployment.Namespace, Name: deployment.Name}, deployment.Spec.Template)
+}
+
+// RecordObjectSpec records the spec of a custom resource, e.g. the RunaiConfig, before it is changed
+func (j *Journal) RecordObjectSpec(resource schema.GroupVersionResource, obj *unstructured.Unstructured) {
+	if j == nil || j.hasUndo(undoObjectSpec, obj.GetNamespace(), obj.GetName()) {
+		return
+	}
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	j.addUndo(UndoRecord{
+		Kind:      undoObjectSpec,
+		Group:     resource.Group,
+		Version:   resource.Version,
+		Resource:  resource.Resource,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}, spec)
+}
+
+// Finish deletes the journal of a completed run
+func (j *Journal) Finish() {
+	if j == nil {
+		return
+	}
+	if active == j {
+		active = nil
+	}
+	err := j.client.GetClientset().CoreV1().ConfigMaps(common.RunaiNamespace).Delete(configMapName, &metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Infof("Failed to delete the journal %s/%s, delete it manually, error: %v", common.RunaiNamespace, configMapName, err)
+	}
+}
+
+func (j *Journal) hasUndo(kind, namespace, name string) bool {
+	for _, record := range j.Undo {
+		if record.Kind == kind && record.Namespace == namespace && record.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *Journal) addUndo(record UndoRecord, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Infof("Failed to record the state of %s, error: %v", record.Name, err)
+		os.Exit(1)
+	}
+	record.Data = raw
+	j.Undo = append(j.Undo, record)
+	j.saveOrExit()
+}
+
+func (j *Journal) saveOrExit() {
+	if err := j.save(); err != nil {
+		log.Infof("Failed to update the journal, error: %v", err)
+		Exit()
+	}
+}
+
+func (j *Journal) save() error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	configMaps := j.client.GetClientset().CoreV1().ConfigMaps(common.RunaiNamespace)
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		var configMap *v1.ConfigMap
+		configMap, err = configMaps.Get(configMapName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configMap = &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: configMapName, Namespace: common.RunaiNamespace},
+				Data:       map[string]string{journalKey: string(data)},
+			}
+			_, err = configMaps.Create(configMap)
+		} else if err == nil {
+			configMap.Data = map[string]string{journalKey: string(data)}
+			_, err = configMaps.Update(configMap)
+		}
+		if err == nil {
+			return nil
+		}
+		log.Debugf("Failed to save the journal, attempt: %v, error: %v", i, err)
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package lock
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Command() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "lock",
+		Short: "Show or break the lock that prevents concurrent runai-adm operations",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.HelpFunc()(cmd, args)
+		},
+	}
+
+	command.AddCommand(status())
+	command.AddCommand(breakLock())
+
+	return command
+}
+
+func status() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "status",
+		Short: "Show which runai-adm operation holds the lock",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			lease, err := client.GetClient().GetClientset().CoordinationV1().Leases(common.RunaiNamespace).Get(leaseName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				fmt.Println("The lock is free")
+				return
+			}
+			if err != nil {
+				log.Errorf("Failed to get the lock %s/%s, error: %v", common.RunaiNamespace, leaseName, err)
+				os.Exit(1)
+			}
+
+			state := "held"
+			if isExpired(lease) {
+				state = "stale, the next operation takes it over"
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "State:\t%s\n", state)
+			fmt.Fprintf(w, "Command:\t%s\n", lease.Annotations[commandAnnotation])
+			fmt.Fprintf(w, "Holder:\t%s\n", holderOf(lease))
+			if lease.Spec.AcquireTime != nil {
+				fmt.Fprintf(w, "Started:\t%s\n", lease.Spec.AcquireTime.UTC().Format(time.RFC3339))
+			}
+			if lease.Spec.RenewTime != nil {
+				fmt.Fprintf(w, "Renewed:\t%s\n", lease.Spec.RenewTime.UTC().Format(time.RFC3339))
+			}
+			w.Flush()
+		},
+	}
+
+	return command
+}
+
+func breakLock() *cobra.Command {
+	var force bool
+	var command = &cobra.Command{
+		Use:   "break",
+		Short: "Delete a stale lock left by an operation that did not finish",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			leases := client.GetClient().GetClientset().CoordinationV1().Leases(common.RunaiNamespace)
+			lease, err := leases.Get(leaseName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				fmt.Println("The lock is free")
+				return
+			}
+			if err != nil {
+				log.Errorf("Failed to get the lock %s/%s, error: %v", common.RunaiNamespace, leaseName, err)
+				os.Exit(1)
+			}
+			if !isExpired(lease) && !force {
+				log.Errorf("%s and renews the lock, use --force to break it anyway", describe(lease))
+				os.Exit(1)
+			}
+
+			uid := lease.UID
+			err = leases.Delete(leaseName, &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+			if err != nil && !apierrors.IsNotFound(err) {
+				log.Errorf("Failed to break the lock, error: %v", err)
+				os.Exit(1)
+			}
+			log.Infof("Broke the lock held by %s", holderOf(lease))
+		},
+	}
+
+	command.Flags().BoolVar(&force, "force", false, "Break the lock even if its holder is still renewing it")
+	return command
+}
@@ -0,0 +1,219 @@
+package lock
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Annotation marks the commands that change the cluster and have to hold the lock while they run
+	Annotation = "runai-adm/lock"
+
+	leaseName         = "runai-adm-lock"
+	commandAnnotation = "run.ai/command"
+
+	leaseDurationSeconds = 30
+	renewInterval        = 10 * time.Second
+)
+
+var held *Lock
+
+// Lock is a coordination.k8s.io Lease in the runai namespace held by the runai-adm command that changes the cluster.
+// The lease is renewed while the command runs, a lease that was not renewed within its duration is stale and taken over.
+type Lock struct {
+	client   *client.Client
+	holder   string
+	stop     chan struct{}
+	stopOnce sync.Once
+	// lost is closed when the lease was taken over or could not be renewed within its duration
+	lost chan struct{}
+}
+
+// Required returns whether a command has to hold the lock. Dry runs do not change the cluster.
+func Required(cmd *cobra.Command) bool {
+	if cmd.Annotations[Annotation] != "true" {
+		return false
+	}
+	dryRun := cmd.Flags().Lookup("dry-run")
+	return dryRun == nil || dryRun.Value.String() != "true"
+}
+
+// AcquireOrExit takes the lock for a command and exits when another admin holds it
+func AcquireOrExit(cmd *cobra.Command) {
+	if held != nil {
+		return
+	}
+	lock, err := Acquire(client.GetClient(), cmd.CommandPath())
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	held = lock
+	go func() {
+		<-lock.Lost()
+		log.Errorf("Stopping '%s', another runai-adm operation may be changing the cluster. Check 'runai-adm lock status' and run 'runai-adm resume' to continue once it is done",
+			cmd.CommandPath())
+		os.Exit(1)
+	}()
+}
+
+// ReleaseHeld releases the lock taken by AcquireOrExit
+func ReleaseHeld() {
+	if held != nil {
+		held.Release()
+		held = nil
+	}
+}
+
+// Acquire creates the lease, or takes it over when it is stale, and renews it until Release is called
+func Acquire(client *client.Client, command string) (*Lock, error) {
+	holder := fmt.Sprintf("%s/%d", common.AdminIdentity(), os.Getpid())
+	leases := client.GetClientset().CoordinationV1().Leases(common.RunaiNamespace)
+
+	var err error
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		var lease *coordinationv1.Lease
+		lease, err = leases.Get(leaseName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = leases.Create(newLease(holder, command))
+			if apierrors.IsNotFound(err) {
+				// the runai namespace does not exist yet, there is nothing to coordinate with
+				log.Debugf("The %s namespace does not exist, running without the lock", common.RunaiNamespace)
+				return &Lock{}, nil
+			}
+		} else if err == nil {
+			if !isExpired(lease) {
+				return nil, fmt.Errorf("%s, run 'runai-adm lock break' if it is stale", describe(lease))
+			}
+			log.Infof("Taking over the stale lock held by %s", holderOf(lease))
+			taken := newLease(holder, command)
+			taken.ObjectMeta = lease.ObjectMeta
+			taken.Annotations = map[string]string{commandAnnotation: command}
+			_, err = leases.Update(taken)
+		}
+		if err == nil {
+			lock := &Lock{client: client, holder: holder, stop: make(chan struct{}), lost: make(chan struct{})}
+			go lock.renew()
+			return lock, nil
+		}
+		if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+			// another admin took the lock at the same time, the next attempt reports who
+			continue
+		}
+		log.Debugf("Failed to take the lock, attempt: %v, error: %v", i, err)
+	}
+	return nil, fmt.Errorf("failed to take the lock %s/%s: %v", common.RunaiNamespace, leaseName, err)
+}
+
+// Release stops renewing the lease and deletes it, unless it was taken over in the meantime
+func (l *Lock) Release() {
+	if l.client == nil {
+		return
+	}
+	l.stopOnce.Do(func() { close(l.stop) })
+
+	leases := l.client.GetClientset().CoordinationV1().Leases(common.RunaiNamespace)
+	lease, err := leases.Get(leaseName, metav1.GetOptions{})
+	if err != nil || holderOf(lease) != l.holder {
+		return
+	}
+	uid := lease.UID
+	err = leases.Delete(leaseName, &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Infof("Failed to release the lock %s/%s, it expires in %d seconds, error: %v", common.RunaiNamespace, leaseName, leaseDurationSeconds, err)
+	}
+}
+
+// Lost returns a channel that is closed when the lock is lost, i.e. taken over by another operation or not renewed
+// within its duration, after which the holder must stop changing the cluster. A lock without a lease is never lost.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lock) renew() {
+	ticker := time.NewTicker(renewInterval)
+	defer ticker.Stop()
+	leases := l.client.GetClientset().CoordinationV1().Leases(common.RunaiNamespace)
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			lease, err := leases.Get(leaseName, metav1.GetOptions{})
+			if err == nil && holderOf(lease) != l.holder {
+				l.markLost(fmt.Sprintf("the lock was taken over by %s", holderOf(lease)))
+				return
+			}
+			if err == nil {
+				now := metav1.NewMicroTime(time.Now())
+				lease.Spec.RenewTime = &now
+				if _, err = leases.Update(lease); err == nil {
+					renewed = now.Time
+					continue
+				}
+			}
+			log.Debugf("Failed to renew the lock, error: %v", err)
+			if time.Since(renewed) > leaseDurationSeconds*time.Second {
+				l.markLost(fmt.Sprintf("the lock could not be renewed for %d seconds and may have been taken over: %v", leaseDurationSeconds, err))
+				return
+			}
+		}
+	}
+}
+
+func (l *Lock) markLost(reason string) {
+	log.Errorf("Lost the lock %s/%s: %s", common.RunaiNamespace, leaseName, reason)
+	close(l.lost)
+}
+
+func newLease(holder, command string) *coordinationv1.Lease {
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(leaseDurationSeconds)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        leaseName,
+			Namespace:   common.RunaiNamespace,
+			Annotations: map[string]string{commandAnnotation: command},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	}
+}
+
+func isExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiry)
+}
+
+func holderOf(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func describe(lease *coordinationv1.Lease) string {
+	started := "an unknown time"
+	if lease.Spec.AcquireTime != nil {
+		started = lease.Spec.AcquireTime.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("'%s' started by %s at %s is still running", lease.Annotations[commandAnnotation], holderOf(lease), started)
+}
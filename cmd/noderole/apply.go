@@ -0,0 +1,274 @@
+package noderole
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/cmd/lock"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// nodeRoleSpec selects the nodes of a role the same way the node-role commands do: by node names or globs,
+// a label selector, or both
+type nodeRoleSpec struct {
+	Nodes    []string `json:"nodes,omitempty"`
+	Selector string   `json:"selector,omitempty"`
+}
+
+// nodeRolesFile is the file of apply node-roles, e.g.
+//
+//	gpuWorker:
+//	  selector: nvidia.com/gpu.present=true
+//	cpuWorker:
+//	  nodes: ["cpu-*"]
+//	runaiSystem:
+//	  nodes: [system-1, system-2]
+type nodeRolesFile struct {
+	GpuWorker   *nodeRoleSpec `json:"gpuWorker,omitempty"`
+	CpuWorker   *nodeRoleSpec `json:"cpuWorker,omitempty"`
+	RunaiSystem *nodeRoleSpec `json:"runaiSystem,omitempty"`
+}
+
+// nodeLabelChange is the change of the role labels of a node
+type nodeLabelChange struct {
+	labelsToSet    []string
+	labelsToRemove []string
+}
+
+func Apply() *cobra.Command {
+	flags := nodeRoleTypes{}
+	filePath := ""
+	prune := false
+	withBackend := false
+	var command = &cobra.Command{
+		Use:         "node-roles",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Aliases:     []string{"node-role"},
+		Short:       "Sync the node roles with a file that maps the roles to node names or selectors",
+		Args:        cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			if filePath == "" {
+				fmt.Println("No node roles file was provided")
+				cmd.HelpFunc()(cmd, args)
+				os.Exit(1)
+			}
+			rolesFile, err := readNodeRolesFile(filePath)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+
+			client := client.GetClient()
+			j := beginJournal(client, flags, "apply node-roles")
+			applyNodeRoles(client, flags, rolesFile, prune, withBackend, j)
+			j.Finish()
+		},
+	}
+
+	command.Flags().StringVarP(&filePath, "file", "f", "", "Path of the node roles file")
+	command.Flags().BoolVar(&prune, "prune", false, "Remove the roles from the nodes the file does not select, including the roles missing from the file")
+	command.Flags().BoolVar(&withBackend, "with-backend", false, "Update backend pods (In Air-gapped environment)")
+	command.Flags().BoolVar(&flags.Taint, "taint", false, "Also taint the nodes that get a role with the NoSchedule taint of the role")
+	addEvictionFlags(command, &flags)
+	addSafetyFlags(command, &flags)
+	addParallelismFlag(command, &flags)
+	command.Flags().BoolVar(&flags.DryRun, "dry-run", false, "Print the label changes and the Run:AI pods, StatefulSets and PVCs that would be moved without changing anything")
+	return command
+}
+
+func readNodeRolesFile(filePath string) (*nodeRolesFile, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	rolesFile := &nodeRolesFile{}
+	if err := yaml.UnmarshalStrict(data, rolesFile); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", filePath, err)
+	}
+	if err := rolesFile.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", filePath, err)
+	}
+	return rolesFile, nil
+}
+
+// validate rejects roles with neither nodes nor a selector, which would select no nodes and, with prune, remove the
+// role from all of them
+func (f *nodeRolesFile) validate() error {
+	for _, role := range []struct {
+		name string
+		spec *nodeRoleSpec
+	}{
+		{"gpuWorker", f.GpuWorker},
+		{"cpuWorker", f.CpuWorker},
+		{"runaiSystem", f.RunaiSystem},
+	} {
+		if role.spec != nil && len(role.spec.Nodes) == 0 && role.spec.Selector == "" {
+			return fmt.Errorf("role %s has neither nodes nor a selector", role.name)
+		}
+	}
+	return nil
+}
+
+// roles maps the role labels to their specs, nil for the roles missing from the file
+func (f *nodeRolesFile) roles() map[string]*nodeRoleSpec {
+	return map[string]*nodeRoleSpec{
+		gpuWorkerLabel:    f.GpuWorker,
+		cpuWorkerLabel:    f.CpuWorker,
+		systemWorkerLabel: f.RunaiSystem,
+	}
+}
+
+// applyNodeRoles labels the nodes the file selects for every role it has, and with prune removes the roles from the
+// other nodes. The Run:AI configurations are updated once, for the roles that changed.
+func applyNodeRoles(client *client.Client, flags nodeRoleTypes, rolesFile *nodeRolesFile, prune, withBackend bool, j *journal.Journal) {
+	nodeList, err := client.GetClientset().CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil || len(nodeList.Items) == 0 {
+		fmt.Println("Failed to list nodes in cluster")
+		j.Finish()
+		os.Exit(1)
+	}
+	nodesInCluster := map[string]v1.Node{}
+	for _, nodeInfo := range nodeList.Items {
+		nodesInCluster[nodeInfo.Name] = nodeInfo
+	}
+
+	changes, err := diffNodeRoles(nodeList.Items, rolesFile, prune)
+	if err != nil {
+		fmt.Println(err)
+		j.Finish()
+		os.Exit(1)
+	}
+	roleFlags := changedRoles(flags, changes)
+	if journal.IsResuming() {
+		// the interrupted run already changed the labels, its configurations still have to be updated
+		for label, spec := range rolesFile.roles() {
+			if spec != nil || prune {
+				setRoleFlag(&roleFlags, label)
+			}
+		}
+	} else if len(changes) == 0 {
+		log.Info("The node roles are in sync with the file")
+		return
+	}
+
+	printNodeRoleDiff(changes)
+	planned := nodesInCluster
+	for _, name := range sortedNodeNames(changes) {
+		planned = plannedNodeLabels(planned, []string{name}, changes[name].labelsToSet, changes[name].labelsToRemove, flags.Taint)
+	}
+	if !journal.IsResuming() {
+		guardNodeRoleChange(client, roleFlags, nodesInCluster, planned, j)
+	}
+	if flags.DryRun {
+		printNodeRolePlan(client, roleFlags, planned, withBackend)
+		return
+	}
+
+	log.Info("Updating nodes with roles")
+	var updates []nodeLabelUpdate
+	for _, name := range sortedNodeNames(changes) {
+		nodeInfo := nodesInCluster[name]
+		j.RecordNodeLabels(&nodeInfo, []string{gpuWorkerLabel, cpuWorkerLabel, systemWorkerLabel})
+		j.RecordNodeTaints(&nodeInfo)
+		updates = append(updates, roleLabelUpdate(nodeInfo, changes[name].labelsToSet, changes[name].labelsToRemove, flags.Taint))
+	}
+	failed := updateNodesAndPrintSummary(client, updates, flags.Parallelism, nodesInCluster)
+	updateRunaiConfigurations(client, roleFlags, nodesInCluster, withBackend, j)
+	exitOnFailedNodes(failed, j)
+	log.Info("Successfully synced the node roles")
+}
+
+// diffNodeRoles computes the role labels to set and, with prune, to remove on every node
+func diffNodeRoles(nodes []v1.Node, rolesFile *nodeRolesFile, prune bool) (map[string]*nodeLabelChange, error) {
+	if err := rolesFile.validate(); err != nil {
+		return nil, err
+	}
+	changes := map[string]*nodeLabelChange{}
+	change := func(name string) *nodeLabelChange {
+		if _, found := changes[name]; !found {
+			changes[name] = &nodeLabelChange{}
+		}
+		return changes[name]
+	}
+
+	for label, spec := range rolesFile.roles() {
+		if spec == nil && !prune {
+			continue
+		}
+		targets := &nodeTargets{matched: map[string]bool{}}
+		if spec != nil {
+			var err error
+			targets, err = newNodeTargets(nodeRoleTypes{Selector: spec.Selector}, spec.Nodes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for i := range nodes {
+			desired := targets.matches(&nodes[i])
+			_, has := nodes[i].Labels[label]
+			switch {
+			case desired && !has:
+				change(nodes[i].Name).labelsToSet = append(change(nodes[i].Name).labelsToSet, label)
+			case !desired && has && prune:
+				change(nodes[i].Name).labelsToRemove = append(change(nodes[i].Name).labelsToRemove, label)
+			}
+		}
+		for _, pattern := range targets.unmatchedPatterns() {
+			log.Infof("Node: %v was not found in cluster", pattern)
+		}
+	}
+	for _, nodeChange := range changes {
+		sort.Strings(nodeChange.labelsToSet)
+		sort.Strings(nodeChange.labelsToRemove)
+	}
+	return changes, nil
+}
+
+// changedRoles returns the flags with the roles that changed on any node
+func changedRoles(flags nodeRoleTypes, changes map[string]*nodeLabelChange) nodeRoleTypes {
+	for _, nodeChange := range changes {
+		for _, label := range append(append([]string{}, nodeChange.labelsToSet...), nodeChange.labelsToRemove...) {
+			setRoleFlag(&flags, label)
+		}
+	}
+	return flags
+}
+
+func setRoleFlag(flags *nodeRoleTypes, label string) {
+	switch label {
+	case gpuWorkerLabel:
+		flags.GpuWorker = true
+	case cpuWorkerLabel:
+		flags.CpuWorker = true
+	case systemWorkerLabel:
+		flags.RunaiSystemWorker = true
+	}
+}
+
+func printNodeRoleDiff(changes map[string]*nodeLabelChange) {
+	for _, name := range sortedNodeNames(changes) {
+		for _, label := range changes[name].labelsToSet {
+			fmt.Printf("node/%s: + %s\n", name, label)
+		}
+		for _, label := range changes[name].labelsToRemove {
+			fmt.Printf("node/%s: - %s\n", name, label)
+		}
+	}
+}
+
+func sortedNodeNames(changes map[string]*nodeLabelChange) []string {
+	var names []string
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
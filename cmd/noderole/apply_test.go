@@ -0,0 +1,87 @@
+package noderole
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiffNodeRoles(t *testing.T) {
+	nodes := []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu-1", Labels: map[string]string{"nvidia.com/gpu.present": "true", gpuWorkerLabel: ""}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu-2", Labels: map[string]string{"nvidia.com/gpu.present": "true"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cpu-1", Labels: map[string]string{gpuWorkerLabel: "", systemWorkerLabel: ""}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "system-1"}},
+	}
+	rolesFile := &nodeRolesFile{
+		GpuWorker: &nodeRoleSpec{Selector: "nvidia.com/gpu.present=true"},
+		CpuWorker: &nodeRoleSpec{Nodes: []string{"cpu-*"}},
+	}
+
+	tests := []struct {
+		name      string
+		rolesFile *nodeRolesFile
+		prune     bool
+		expected  map[string]*nodeLabelChange
+		wantErr   bool
+	}{
+		{
+			name:      "without prune",
+			rolesFile: rolesFile,
+			expected: map[string]*nodeLabelChange{
+				"gpu-2": {labelsToSet: []string{gpuWorkerLabel}},
+				"cpu-1": {labelsToSet: []string{cpuWorkerLabel}},
+			},
+		},
+		{
+			name:      "with prune",
+			rolesFile: rolesFile,
+			prune:     true,
+			expected: map[string]*nodeLabelChange{
+				"gpu-2": {labelsToSet: []string{gpuWorkerLabel}},
+				"cpu-1": {labelsToSet: []string{cpuWorkerLabel}, labelsToRemove: []string{gpuWorkerLabel, systemWorkerLabel}},
+			},
+		},
+		{
+			name:      "nodes and selector",
+			rolesFile: &nodeRolesFile{RunaiSystem: &nodeRoleSpec{Nodes: []string{"*-1"}, Selector: "nvidia.com/gpu.present=true"}},
+			expected: map[string]*nodeLabelChange{
+				"gpu-1": {labelsToSet: []string{systemWorkerLabel}},
+			},
+		},
+		{
+			name:      "nothing to change",
+			rolesFile: &nodeRolesFile{RunaiSystem: &nodeRoleSpec{Nodes: []string{"cpu-1", "missing"}}},
+			expected:  map[string]*nodeLabelChange{},
+		},
+		{
+			name:      "role without nodes or selector",
+			rolesFile: &nodeRolesFile{GpuWorker: &nodeRoleSpec{}},
+			prune:     true,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid selector",
+			rolesFile: &nodeRolesFile{GpuWorker: &nodeRoleSpec{Selector: "a b"}},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid pattern",
+			rolesFile: &nodeRolesFile{CpuWorker: &nodeRoleSpec{Nodes: []string{"cpu-["}}},
+			wantErr:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := diffNodeRoles(nodes, test.rolesFile, test.prune)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("diffNodeRoles() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(changes, test.expected) {
+				t.Errorf("diffNodeRoles() = %v, expected %v", changes, test.expected)
+			}
+		})
+	}
+}
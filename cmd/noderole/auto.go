@@ -0,0 +1,220 @@
+package noderole
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/cmd/lock"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	controlPlaneLabels = []string{"node-role.kubernetes.io/master", "node-role.kubernetes.io/control-plane"}
+
+	// labels of node-feature-discovery and gpu-feature-discovery that mark a node with an NVIDIA GPU
+	gpuFeatureLabels = map[string]string{
+		"feature.node.kubernetes.io/pci-10de.present": "true",
+		"nvidia.com/gpu.present":                      "true",
+	}
+)
+
+// roleAssignment is the worker role detected for a node
+type roleAssignment struct {
+	node      v1.Node
+	gpuWorker bool
+	taint     bool
+	reason    string
+}
+
+func (a roleAssignment) label() string {
+	if a.gpuWorker {
+		return gpuWorkerLabel
+	}
+	return cpuWorkerLabel
+}
+
+func (a roleAssignment) otherLabel() string {
+	if a.gpuWorker {
+		return cpuWorkerLabel
+	}
+	return gpuWorkerLabel
+}
+
+func (a roleAssignment) isCurrent() bool {
+	_, hasLabel := a.node.Labels[a.label()]
+	_, hasOtherLabel := a.node.Labels[a.otherLabel()]
+	if a.taint && !hasRoleTaint(&a.node, a.label()) {
+		return false
+	}
+	return hasLabel && !hasOtherLabel && !hasRoleTaint(&a.node, a.otherLabel())
+}
+
+// setDetectedNodeRoles assigns the GPU worker role to the nodes with NVIDIA GPUs and the CPU worker role to all other
+// nodes, skipping control-plane nodes. The assignment is confirmed by the user before it is applied, and the Run:AI
+// configurations are updated once for all the nodes.
+func setDetectedNodeRoles(client *client.Client, flags nodeRoleTypes, args []string, withBackend, yes bool, j *journal.Journal) {
+	targets, err := newNodeTargets(flags, args)
+	if err != nil {
+		fmt.Println(err)
+		j.Finish()
+		os.Exit(1)
+	}
+	if !hasNodeTargets(flags, args) {
+		targets.all = true
+	}
+
+	nodes, err := client.GetClientset().CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil || len(nodes.Items) == 0 {
+		fmt.Println("Failed to list nodes in cluster")
+		j.Finish()
+		os.Exit(1)
+	}
+
+	var assignments []roleAssignment
+	var skipped []string
+	for _, node := range nodes.Items {
+		if !targets.matches(&node) {
+			continue
+		}
+		if isControlPlane(&node) {
+			skipped = append(skipped, node.Name)
+			continue
+		}
+		assignment := detectNodeRole(node)
+		assignment.taint = flags.Taint
+		assignments = append(assignments, assignment)
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		return assignments[i].node.Name < assignments[j].node.Name
+	})
+
+	printAssignments(assignments, skipped)
+	changed := 0
+	for _, assignment := range assignments {
+		if !assignment.isCurrent() {
+			changed++
+		}
+	}
+	if changed == 0 && !journal.IsResuming() {
+		log.Infof("All nodes already have their detected roles")
+		return
+	}
+	if changed > 0 && !yes && !flags.DryRun && !confirmAssignments(changed) {
+		// an unconfirmed run, e.g. a script without --yes, must not pass for a successful one
+		log.Error("Node roles were not changed")
+		j.Finish()
+		lock.ReleaseHeld()
+		os.Exit(1)
+	}
+
+	nodesInCluster := map[string]v1.Node{}
+	for _, node := range nodes.Items {
+		nodesInCluster[node.Name] = node
+	}
+	if !journal.IsResuming() {
+		planned := nodesInCluster
+		for _, assignment := range assignments {
+			if !assignment.isCurrent() {
+				planned = plannedNodeLabels(planned, []string{assignment.node.Name}, []string{assignment.label()}, []string{assignment.otherLabel()}, flags.Taint)
+			}
+		}
+		roleFlags := flags
+		roleFlags.GpuWorker, roleFlags.CpuWorker = true, true
+		guardNodeRoleChange(client, roleFlags, nodesInCluster, planned, j)
+	}
+	var updates []nodeLabelUpdate
+	for _, assignment := range assignments {
+		if assignment.isCurrent() {
+			continue
+		}
+		node := assignment.node
+		if flags.DryRun {
+			simulateNodeLabels(&node, []string{assignment.label()}, []string{assignment.otherLabel()}, flags.Taint)
+			nodesInCluster[node.Name] = node
+		} else {
+			j.RecordNodeLabels(&node, []string{gpuWorkerLabel, cpuWorkerLabel})
+			j.RecordNodeTaints(&node)
+			updates = append(updates, roleLabelUpdate(node, []string{assignment.label()}, []string{assignment.otherLabel()}, flags.Taint))
+		}
+	}
+	failed := updateNodesAndPrintSummary(client, updates, flags.Parallelism, nodesInCluster)
+
+	roleFlags := flags
+	roleFlags.GpuWorker = true
+	roleFlags.CpuWorker = true
+	if flags.DryRun {
+		printNodeRolePlan(client, roleFlags, nodesInCluster, withBackend)
+		return
+	}
+	updateRunaiConfigurations(client, roleFlags, nodesInCluster, withBackend, j)
+	exitOnFailedNodes(failed, j)
+}
+
+// detectNodeRole checks the NVIDIA GPU capacity and allocatable resources of a node and its GPU feature labels
+func detectNodeRole(node v1.Node) roleAssignment {
+	capacity := node.Status.Capacity[gpuResourceName]
+	allocatable := node.Status.Allocatable[gpuResourceName]
+	switch {
+	case capacity.Value() > 0 || allocatable.Value() > 0:
+		return roleAssignment{node: node, gpuWorker: true, reason: fmt.Sprintf("%s capacity %d, allocatable %d", gpuResourceName, capacity.Value(), allocatable.Value())}
+	case gpuFeatureLabel(&node) != "":
+		return roleAssignment{node: node, gpuWorker: true, reason: "label " + gpuFeatureLabel(&node)}
+	default:
+		return roleAssignment{node: node, reason: "no NVIDIA GPUs found"}
+	}
+}
+
+// gpuFeatureLabel returns the GPU feature label of a node, or an empty string when it has none
+func gpuFeatureLabel(node *v1.Node) string {
+	for label, value := range gpuFeatureLabels {
+		if node.Labels[label] == value {
+			return label + "=" + value
+		}
+	}
+	return ""
+}
+
+func isControlPlane(node *v1.Node) bool {
+	for _, label := range controlPlaneLabels {
+		if _, found := node.Labels[label]; found {
+			return true
+		}
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == label {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func printAssignments(assignments []roleAssignment, skipped []string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "NODE\tROLE\tCHANGE\tREASON\n")
+	for _, assignment := range assignments {
+		change := "unchanged"
+		if !assignment.isCurrent() {
+			change = "set"
+		}
+		role := strings.TrimPrefix(assignment.label(), "node-role.kubernetes.io/")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", assignment.node.Name, role, change, assignment.reason)
+	}
+	for _, name := range skipped {
+		fmt.Fprintf(w, "%s\t-\tskipped\tcontrol-plane node\n", name)
+	}
+	w.Flush()
+}
+
+func confirmAssignments(changed int) bool {
+	fmt.Printf("\nType 'yes' to set the roles of %d nodes: ", changed)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
@@ -0,0 +1,304 @@
+package noderole
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const backendReleaseName = "runai-backend"
+
+var (
+	fluxHelmReleaseResource         = schema.GroupVersionResource{Group: "helm.toolkit.fluxcd.io", Version: "v2beta1", Resource: "helmreleases"}
+	helmOperatorHelmReleaseResource = schema.GroupVersionResource{Group: "helm.fluxcd.io", Version: "v1", Resource: "helmreleases"}
+
+	gzipHeader = []byte{0x1f, 0x8b, 0x08}
+)
+
+// backendRelease is the release of the Run:AI backend chart, managed by Flux v2, by the legacy helm-operator
+// or installed by Helm 3 directly
+type backendRelease interface {
+	describe() string
+	// operator returns the deployment that reconciles the release, when it is part of the Run:AI backend
+	operator() (namespace, name string, found bool)
+	values(client *client.Client) (map[string]interface{}, error)
+	// updateValues applies mutate to the chart values and writes them back when mutate changed them
+	updateValues(client *client.Client, j *journal.Journal, mutate func(values map[string]interface{}) bool) error
+}
+
+// detectBackend finds the mechanism that manages the runai-backend release
+func detectBackend(client *client.Client) (backendRelease, error) {
+	for _, release := range []*helmReleaseBackend{
+		{resource: fluxHelmReleaseResource, kind: "Flux v2 HelmRelease"},
+		{resource: helmOperatorHelmReleaseResource, kind: "helm-operator HelmRelease", operatorName: common.RunaiBackendOperatorDeploymentName},
+	} {
+		_, err := client.GetDynamicClient().Resource(release.resource).Namespace(common.RunaiBackendNamespace).Get(backendReleaseName, metav1.GetOptions{})
+		if err == nil {
+			return release, nil
+		}
+		log.Debugf("The backend is not managed by a %s: %v", release.kind, err)
+	}
+
+	_, err := getHelm3ReleaseSecret(client)
+	if err == nil {
+		return &helm3Backend{}, nil
+	}
+	log.Debugf("The backend is not a Helm 3 release: %v", err)
+	return nil, fmt.Errorf("the %s release was not found as a Flux v2 HelmRelease, a helm-operator HelmRelease or a Helm 3 release in the %s namespace, Run:AI Backend is not installed on the cluster",
+		backendReleaseName, common.RunaiBackendNamespace)
+}
+
+func detectBackendOrExit(client *client.Client) backendRelease {
+	backend, err := detectBackend(client)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	log.Debugf("The backend is a %s", backend.describe())
+	return backend
+}
+
+// helmReleaseBackend is a HelmRelease custom resource, whose chart values are in spec.values
+type helmReleaseBackend struct {
+	resource     schema.GroupVersionResource
+	kind         string
+	operatorName string
+}
+
+func (b *helmReleaseBackend) describe() string {
+	return b.kind
+}
+
+func (b *helmReleaseBackend) operator() (string, string, bool) {
+	return common.RunaiBackendNamespace, b.operatorName, b.operatorName != ""
+}
+
+func (b *helmReleaseBackend) values(client *client.Client) (map[string]interface{}, error) {
+	release, err := client.GetDynamicClient().Resource(b.resource).Namespace(common.RunaiBackendNamespace).Get(backendReleaseName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	values, _, err := unstructured.NestedMap(release.Object, "spec", "values")
+	return values, err
+}
+
+func (b *helmReleaseBackend) updateValues(client *client.Client, j *journal.Journal, mutate func(values map[string]interface{}) bool) error {
+	releases := client.GetDynamicClient().Resource(b.resource).Namespace(common.RunaiBackendNamespace)
+	var err error
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		var release *unstructured.Unstructured
+		release, err = releases.Get(backendReleaseName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		values, _, nestedErr := unstructured.NestedMap(release.Object, "spec", "values")
+		if nestedErr != nil {
+			return nestedErr
+		}
+		if values == nil {
+			values = map[string]interface{}{}
+		}
+		if !mutate(values) {
+			return nil
+		}
+		j.RecordObjectSpec(b.resource, release)
+		if err = unstructured.SetNestedMap(release.Object, values, "spec", "values"); err != nil {
+			return err
+		}
+		_, err = releases.Update(release, metav1.UpdateOptions{})
+		if err == nil {
+			return nil
+		}
+		log.Debugf("Failed to update the %s, attempt: %v, error: %v", b.kind, i, err)
+	}
+	return err
+}
+
+// helm3Backend is a release installed by Helm 3, which stores the release, including the user supplied values,
+// in a Secret for every revision. Its values are only read.
+type helm3Backend struct{}
+
+func (b *helm3Backend) describe() string {
+	return "Helm 3 release"
+}
+
+func (b *helm3Backend) operator() (string, string, bool) {
+	return "", "", false
+}
+
+func (b *helm3Backend) values(client *client.Client) (map[string]interface{}, error) {
+	release, err := getHelm3Release(client)
+	if err != nil {
+		return nil, err
+	}
+	values, _ := release["config"].(map[string]interface{})
+	return values, nil
+}
+
+// updateValues does not write the values: the release Secret of Helm 3 is Helm's storage, and has the values of
+// all the backend charts, so it is neither changed nor journaled. When the values change it fails with the helm
+// upgrade that sets them, the backend pods are only changed by that upgrade.
+func (b *helm3Backend) updateValues(client *client.Client, j *journal.Journal, mutate func(values map[string]interface{}) bool) error {
+	release, err := getHelm3Release(client)
+	if err != nil {
+		return err
+	}
+	values, _ := release["config"].(map[string]interface{})
+	updated := runtime.DeepCopyJSON(values)
+	if updated == nil {
+		updated = map[string]interface{}{}
+	}
+	if !mutate(updated) {
+		return nil
+	}
+	return &manualUpgradeError{command: helm3UpgradeCommand(release, values, updated)}
+}
+
+// manualUpgradeError is returned when the backend values can only be rolled out by running command
+type manualUpgradeError struct {
+	command string
+}
+
+func (e *manualUpgradeError) Error() string {
+	return fmt.Sprintf("the values of a Helm 3 release are not changed by runai-adm, run '%s' to roll out the new values to the backend", e.command)
+}
+
+// helm3UpgradeCommand returns the helm upgrade of the release that sets the values that changed
+func helm3UpgradeCommand(release, oldValues, newValues map[string]interface{}) string {
+	chart, found, _ := unstructured.NestedString(release, "chart", "metadata", "name")
+	if !found || chart == "" {
+		chart = "<chart>"
+	}
+	command := []string{"helm", "upgrade", backendReleaseName, chart, "-n", common.RunaiBackendNamespace, "--reuse-values"}
+	return strings.Join(append(command, helmSetFlags(oldValues, newValues, "")...), " ")
+}
+
+// helmSetFlags returns the --set flags of the scalar values that differ between the old and the new values
+func helmSetFlags(oldValues, newValues map[string]interface{}, prefix string) []string {
+	var keys []string
+	for key := range newValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var flags []string
+	for _, key := range keys {
+		path := prefix + key
+		if nested, isMap := newValues[key].(map[string]interface{}); isMap {
+			oldNested, _ := oldValues[key].(map[string]interface{})
+			flags = append(flags, helmSetFlags(oldNested, nested, path+".")...)
+			continue
+		}
+		if !reflect.DeepEqual(oldValues[key], newValues[key]) {
+			flags = append(flags, fmt.Sprintf("--set %s=%v", path, newValues[key]))
+		}
+	}
+	return flags
+}
+
+// getHelm3ReleaseSecret returns the Secret of the deployed revision of the backend release
+func getHelm3ReleaseSecret(client *client.Client) (*v1.Secret, error) {
+	secrets, err := client.GetClientset().CoreV1().Secrets(common.RunaiBackendNamespace).List(metav1.ListOptions{
+		LabelSelector: "owner=helm,status=deployed,name=" + backendReleaseName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var deployed *v1.Secret
+	latestVersion := -1
+	for i, secret := range secrets.Items {
+		version, _ := strconv.Atoi(secret.Labels["version"])
+		if version > latestVersion {
+			deployed, latestVersion = &secrets.Items[i], version
+		}
+	}
+	if deployed == nil {
+		return nil, fmt.Errorf("no deployed revision of %s was found", backendReleaseName)
+	}
+	return deployed, nil
+}
+
+func getHelm3Release(client *client.Client) (map[string]interface{}, error) {
+	secret, err := getHelm3ReleaseSecret(client)
+	if err != nil {
+		return nil, err
+	}
+	return decodeHelm3Release(secret)
+}
+
+// decodeHelm3Release decodes the release of a Helm 3 Secret: base64 encoded, usually gzipped, JSON
+func decodeHelm3Release(secret *v1.Secret) (map[string]interface{}, error) {
+	data, err := base64.StdEncoding.DecodeString(string(secret.Data["release"]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the release in secret %s: %v", secret.Name, err)
+	}
+	if bytes.HasPrefix(data, gzipHeader) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress the release in secret %s: %v", secret.Name, err)
+		}
+		defer reader.Close()
+		if data, err = ioutil.ReadAll(reader); err != nil {
+			return nil, fmt.Errorf("failed to decompress the release in secret %s: %v", secret.Name, err)
+		}
+	}
+	var release map[string]interface{}
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, fmt.Errorf("failed to parse the release in secret %s: %v", secret.Name, err)
+	}
+	return release, nil
+}
+
+// updateBackendIfNeeded sets restrictRunaiSystem in the global nodeAffinity values of the backend release
+func updateBackendIfNeeded(client *client.Client, flags nodeRoleTypes, backend backendRelease, nodeWithRestrictRunaiSystemExist bool, j *journal.Journal) {
+	if !flags.RunaiSystemWorker {
+		return
+	}
+	err := backend.updateValues(client, j, func(values map[string]interface{}) bool {
+		nodeAffinityMapOldValues, _, _ := unstructured.NestedMap(values, "global", "nodeAffinity")
+		log.Debugf("%s old values of nodeAffinityMap: %v", backend.describe(), nodeAffinityMapOldValues)
+		nodeAffinityMap := desiredBackendNodeAffinity(nodeAffinityMapOldValues, nodeWithRestrictRunaiSystemExist)
+		if reflect.DeepEqual(nodeAffinityMap, nodeAffinityMapOldValues) {
+			return false
+		}
+		log.Debugf("Updating %s with nodeAffinityMap: %v", backend.describe(), nodeAffinityMap)
+		unstructured.SetNestedMap(values, nodeAffinityMap, "global", "nodeAffinity")
+		return true
+	})
+	if upgradeErr, isManual := err.(*manualUpgradeError); isManual {
+		// the rest of the configurations are updated, running the command again only prints the upgrade again
+		log.Error(upgradeErr)
+		j.Finish()
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Infof("Failed to update the %s, error: %v", backend.describe(), err)
+		journal.Exit()
+	}
+}
+
+func desiredBackendNodeAffinity(nodeAffinityMapOldValues map[string]interface{}, nodeWithRestrictRunaiSystemExist bool) map[string]interface{} {
+	nodeAffinityMap := map[string]interface{}{}
+	for key, val := range nodeAffinityMapOldValues {
+		nodeAffinityMap[key] = val
+	}
+	nodeAffinityMap["restrictRunaiSystem"] = nodeWithRestrictRunaiSystemExist
+	return nodeAffinityMap
+}
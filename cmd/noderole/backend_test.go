@@ -0,0 +1,123 @@
+package noderole
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func helm3ReleaseSecret(t *testing.T, release string, compress bool) *v1.Secret {
+	data := []byte(release)
+	if compress {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = compressed.Bytes()
+	}
+	return &v1.Secret{Data: map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(data))}}
+}
+
+func TestDecodeHelm3Release(t *testing.T) {
+	release := `{"name":"runai-backend","config":{"global":{"nodeAffinity":{"restrictRunaiSystem":true}}}}`
+	expected := map[string]interface{}{
+		"name": "runai-backend",
+		"config": map[string]interface{}{
+			"global": map[string]interface{}{"nodeAffinity": map[string]interface{}{"restrictRunaiSystem": true}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		secret   *v1.Secret
+		expected map[string]interface{}
+		wantErr  bool
+	}{
+		{name: "gzipped", secret: helm3ReleaseSecret(t, release, true), expected: expected},
+		{name: "plain", secret: helm3ReleaseSecret(t, release, false), expected: expected},
+		{name: "not base64", secret: &v1.Secret{Data: map[string][]byte{"release": []byte("%%%")}}, wantErr: true},
+		{name: "not json", secret: helm3ReleaseSecret(t, "runai", true), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := decodeHelm3Release(test.secret)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("decodeHelm3Release() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(decoded, test.expected) {
+				t.Errorf("decodeHelm3Release() = %v, expected %v", decoded, test.expected)
+			}
+		})
+	}
+}
+
+func TestHelmSetFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		oldValues map[string]interface{}
+		newValues map[string]interface{}
+		expected  []string
+	}{
+		{
+			name:      "unchanged",
+			oldValues: map[string]interface{}{"global": map[string]interface{}{"nodeAffinity": map[string]interface{}{"restrictRunaiSystem": true}}},
+			newValues: map[string]interface{}{"global": map[string]interface{}{"nodeAffinity": map[string]interface{}{"restrictRunaiSystem": true}}},
+		},
+		{
+			name:      "changed",
+			oldValues: map[string]interface{}{"global": map[string]interface{}{"nodeAffinity": map[string]interface{}{"restrictRunaiSystem": true, "other": 1}}},
+			newValues: map[string]interface{}{"global": map[string]interface{}{"nodeAffinity": map[string]interface{}{"restrictRunaiSystem": false, "other": 1}}},
+			expected:  []string{"--set global.nodeAffinity.restrictRunaiSystem=false"},
+		},
+		{
+			name:      "added to empty values",
+			oldValues: nil,
+			newValues: map[string]interface{}{"global": map[string]interface{}{"nodeAffinity": map[string]interface{}{"restrictRunaiSystem": true}}},
+			expected:  []string{"--set global.nodeAffinity.restrictRunaiSystem=true"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if flags := helmSetFlags(test.oldValues, test.newValues, ""); !reflect.DeepEqual(flags, test.expected) {
+				t.Errorf("helmSetFlags() = %v, expected %v", flags, test.expected)
+			}
+		})
+	}
+}
+
+func TestHelm3UpgradeCommand(t *testing.T) {
+	oldValues := map[string]interface{}{"global": map[string]interface{}{"nodeAffinity": map[string]interface{}{"restrictRunaiSystem": false}}}
+	newValues := map[string]interface{}{"global": map[string]interface{}{"nodeAffinity": map[string]interface{}{"restrictRunaiSystem": true}}}
+
+	tests := []struct {
+		name     string
+		release  map[string]interface{}
+		expected string
+	}{
+		{
+			name:     "chart of the release",
+			release:  map[string]interface{}{"chart": map[string]interface{}{"metadata": map[string]interface{}{"name": "runai-backend"}}},
+			expected: "helm upgrade runai-backend runai-backend -n runai-backend --reuse-values --set global.nodeAffinity.restrictRunaiSystem=true",
+		},
+		{
+			name:     "no chart",
+			release:  map[string]interface{}{},
+			expected: "helm upgrade runai-backend <chart> -n runai-backend --reuse-values --set global.nodeAffinity.restrictRunaiSystem=true",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if command := helm3UpgradeCommand(test.release, oldValues, newValues); command != test.expected {
+				t.Errorf("helm3UpgradeCommand() = %q, expected %q", command, test.expected)
+			}
+		})
+	}
+}
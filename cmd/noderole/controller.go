@@ -0,0 +1,445 @@
+package noderole
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/cmd/lock"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	controllerComponent   = "runai-node-role-controller"
+	defaultResyncInterval = 10 * time.Minute
+
+	eventRoleAssigned        = "RunaiRoleAssigned"
+	eventRoleAssignFailed    = "RunaiRoleAssignFailed"
+	eventRoleAssignSkipped   = "RunaiRoleAssignSkipped"
+	eventNodeAffinityChanged = "RunaiNodeAffinityChanged"
+	eventNodeAffinityFailed  = "RunaiNodeAffinityUpdateFailed"
+	eventRestrictionKept     = "RunaiRestrictionKept"
+
+	// the queue key that only syncs the restrictions, node names are never empty
+	restrictionsKey              = ""
+	maxNodeRoleControllerRetries = 5
+	// the interval to retry while runai-adm holds the lock or an interrupted run has to be resumed or aborted
+	busyRetryInterval = 30 * time.Second
+)
+
+// restrictionState is the cluster-wide restriction that the role labels and taints of the nodes imply
+type restrictionState struct {
+	restrictScheduling  bool
+	restrictRunaiSystem bool
+	taintedRoles        map[string]bool
+}
+
+// busyError is returned while the controller must not change the cluster, the key is retried without counting it
+type busyError struct {
+	reason string
+}
+
+func (e *busyError) Error() string {
+	return e.reason
+}
+
+// nodeRoleController assigns roles to nodes by the selector rules of a node roles file as they join the cluster, and
+// turns on the nodeAffinity flags of the RunaiConfig, and the tolerations of the taints it sets, as the roles appear.
+// It never removes roles and never turns a restriction off, that is left to remove node-role with its safety checks.
+// It changes the cluster only while holding the runai-adm lock and when no interrupted run has to be resumed.
+type nodeRoleController struct {
+	client      *client.Client
+	rules       map[string]*nodeTargets
+	taint       bool
+	factory     informers.SharedInformerFactory
+	nodeLister  corelisters.NodeLister
+	nodesSynced cache.InformerSynced
+	queue       workqueue.RateLimitingInterface
+	recorder    record.EventRecorder
+	// the restriction state last written to or read from the RunaiConfig, nil until the first sync
+	restrictions *restrictionState
+}
+
+func Controller() *cobra.Command {
+	rulesPath := ""
+	taint := false
+	resync := defaultResyncInterval
+	var command = &cobra.Command{
+		Use:     "node-roles",
+		Aliases: []string{"node-role"},
+		Short:   "Run a controller that assigns roles to joining nodes by the selector rules of a node roles file",
+		Args:    cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			if rulesPath == "" {
+				fmt.Println("No rules file was provided")
+				cmd.HelpFunc()(cmd, args)
+				os.Exit(1)
+			}
+			rolesFile, err := readNodeRolesFile(rulesPath)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			controller, err := newNodeRoleController(client.GetClient(), rolesFile, taint, resync)
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			if err := controller.run(stopOnSignal()); err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	command.Flags().StringVar(&rulesPath, "rules", "", "Path of the node roles file with the rules, in the format of apply node-roles")
+	command.Flags().BoolVar(&taint, "taint", false, "Also taint the nodes that get a role with the NoSchedule taint of the role")
+	command.Flags().DurationVar(&resync, "resync", defaultResyncInterval, "Interval to recheck all the nodes")
+	return command
+}
+
+func newNodeRoleController(client *client.Client, rolesFile *nodeRolesFile, taint bool, resync time.Duration) (*nodeRoleController, error) {
+	rules := map[string]*nodeTargets{}
+	for label, spec := range rolesFile.roles() {
+		if spec == nil {
+			continue
+		}
+		targets, err := newNodeTargets(nodeRoleTypes{Selector: spec.Selector}, spec.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		rules[label] = targets
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("the rules file has no roles")
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(log.Debugf)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.GetClientset().CoreV1().Events("")})
+
+	factory := informers.NewSharedInformerFactory(client.GetClientset(), resync)
+	nodeInformer := factory.Core().V1().Nodes()
+	c := &nodeRoleController{
+		client:      client,
+		rules:       rules,
+		taint:       taint,
+		factory:     factory,
+		nodeLister:  nodeInformer.Lister(),
+		nodesSynced: nodeInformer.Informer().HasSynced,
+		queue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "node-roles"),
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: controllerComponent}),
+	}
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(_, obj interface{}) {
+			c.enqueue(obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			// a deleted node may have been the last one of a role
+			c.queue.Add(restrictionsKey)
+		},
+	})
+	return c, nil
+}
+
+func (c *nodeRoleController) enqueue(obj interface{}) {
+	if node, ok := obj.(*v1.Node); ok {
+		c.queue.Add(node.Name)
+	}
+}
+
+func (c *nodeRoleController) run(stop <-chan struct{}) error {
+	defer c.queue.ShutDown()
+
+	c.factory.Start(stop)
+	log.Info("Waiting for the nodes to be synced")
+	if !cache.WaitForCacheSync(stop, c.nodesSynced) {
+		return fmt.Errorf("failed to sync the nodes")
+	}
+	log.Infof("Started the node role controller with rules for: %s", strings.Join(c.ruleRoles(), ", "))
+
+	go wait.Until(c.runWorker, time.Second, stop)
+	<-stop
+	log.Info("Stopping the node role controller")
+	return nil
+}
+
+func (c *nodeRoleController) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+func (c *nodeRoleController) processNextItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	err := c.sync(key.(string))
+	if err == nil {
+		c.queue.Forget(key)
+		return true
+	}
+	if busy, isBusy := err.(*busyError); isBusy {
+		log.Infof("Delaying the sync of %s: %s", key, busy.reason)
+		c.queue.Forget(key)
+		c.queue.AddAfter(key, busyRetryInterval)
+		return true
+	}
+	if c.queue.NumRequeues(key) < maxNodeRoleControllerRetries {
+		log.Infof("Failed to sync %s, retrying: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	log.Errorf("Failed to sync %s, giving up: %v", key, err)
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *nodeRoleController) sync(key string) error {
+	var node *v1.Node
+	var labelsToSet []string
+	if key != restrictionsKey {
+		var err error
+		if node, labelsToSet, err = c.missingRoles(key); err != nil {
+			return err
+		}
+	}
+	state, err := c.restrictionState()
+	if err != nil {
+		return err
+	}
+	if len(labelsToSet) == 0 && c.restrictions != nil && reflect.DeepEqual(*c.restrictions, state) {
+		return nil
+	}
+
+	l, err := c.acquire()
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	// the restrictions of the roles set now are synced by the update event of the node
+	if len(labelsToSet) > 0 {
+		if err := c.assignRoles(node, labelsToSet); err != nil {
+			return err
+		}
+	}
+	select {
+	case <-l.Lost():
+		return &busyError{reason: "the lock was lost"}
+	default:
+	}
+	return c.syncRestrictions(state)
+}
+
+// acquire takes the runai-adm lock, so that the controller does not change the cluster while an admin runs a command
+// that does, e.g. while set node-role or upgrade have the operator scaled down
+func (c *nodeRoleController) acquire() (*lock.Lock, error) {
+	l, err := lock.Acquire(c.client, controllerComponent)
+	if err != nil {
+		return nil, &busyError{reason: err.Error()}
+	}
+	interrupted, err := journal.Get(c.client)
+	if err == nil && interrupted != nil {
+		err = fmt.Errorf("an interrupted '%s' has to be resumed or aborted first", interrupted.Command)
+	}
+	if err != nil {
+		l.Release()
+		return nil, &busyError{reason: err.Error()}
+	}
+	return l, nil
+}
+
+// missingRoles returns the roles whose rules match the node and that it does not have yet
+func (c *nodeRoleController) missingRoles(name string) (*v1.Node, []string, error) {
+	node, err := c.nodeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var labelsToSet []string
+	for label, targets := range c.rules {
+		if _, has := node.Labels[label]; !has && targets.matches(node) {
+			labelsToSet = append(labelsToSet, label)
+		}
+	}
+	sort.Strings(labelsToSet)
+	return node, labelsToSet, nil
+}
+
+// assignRoles sets the roles on the node, with their taints when --taint is set. A node whose roles would violate the
+// safety checks of set node-role, e.g. one that is not Ready yet, is skipped until its next update.
+func (c *nodeRoleController) assignRoles(node *v1.Node, labelsToSet []string) error {
+	nodesInCluster, err := c.listNodes()
+	if err != nil {
+		return err
+	}
+	flags := nodeRoleTypes{MinSystemNodes: defaultMinSystemNodes}
+	for _, label := range labelsToSet {
+		setRoleFlag(&flags, label)
+	}
+	planned := plannedNodeLabels(nodesInCluster, []string{node.Name}, labelsToSet, nil, c.taint)
+	if violations := nodeRoleViolations(c.client, flags, nodesInCluster, planned); len(violations) > 0 {
+		log.Infof("Skipping roles %s of node %s: %s", strings.Join(labelsToSet, ", "), node.Name, strings.Join(violations, "; "))
+		c.recorder.Eventf(node, v1.EventTypeWarning, eventRoleAssignSkipped, "Run:AI roles %s were not set: %s", strings.Join(labelsToSet, ", "), strings.Join(violations, "; "))
+		return nil
+	}
+
+	if result := patchNode(c.client, roleLabelUpdate(*node, labelsToSet, nil, c.taint)); result.err != nil {
+		c.recorder.Eventf(node, v1.EventTypeWarning, eventRoleAssignFailed, "Failed to set Run:AI roles %s: %v", strings.Join(labelsToSet, ", "), result.err)
+		return result.err
+	}
+	log.Infof("Set roles %s on node %s", strings.Join(labelsToSet, ", "), node.Name)
+	c.recorder.Eventf(node, v1.EventTypeNormal, eventRoleAssigned, "Set Run:AI roles %s by the rules of %s", strings.Join(labelsToSet, ", "), controllerComponent)
+	return nil
+}
+
+func (c *nodeRoleController) listNodes() (map[string]v1.Node, error) {
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	nodesInCluster := map[string]v1.Node{}
+	for _, node := range nodes {
+		nodesInCluster[node.Name] = *node
+	}
+	return nodesInCluster, nil
+}
+
+// restrictionState computes the restrictions from the nodes of the lister
+func (c *nodeRoleController) restrictionState() (restrictionState, error) {
+	nodesInCluster, err := c.listNodes()
+	if err != nil {
+		return restrictionState{}, err
+	}
+	state := restrictionState{taintedRoles: roleTaintsExist(nodesInCluster)}
+	state.restrictScheduling, state.restrictRunaiSystem = nodeRolesExist(nodesInCluster)
+	return state, nil
+}
+
+// syncRestrictions turns on restrictScheduling and restrictRunaiSystem of the RunaiConfig, and adds the tolerations
+// of the tainted roles to it and to the operator, when the roles of the nodes require it. A restriction whose last
+// node is gone is kept, with a Warning event.
+func (c *nodeRoleController) syncRestrictions(state restrictionState) error {
+	runaiConfigs := c.client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace)
+	var err error
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		var runaiConfig *unstructured.Unstructured
+		runaiConfig, err = runaiConfigs.Get(common.RunaiConfigName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get RunaiConfig: %v", err)
+		}
+		oldValues, _, _ := unstructured.NestedMap(runaiConfig.Object, "spec", "global", "nodeAffinity")
+		restrictScheduling := state.restrictScheduling || oldValues["restrictScheduling"] == true
+		restrictRunaiSystem := state.restrictRunaiSystem || oldValues["restrictRunaiSystem"] == true
+		if i == 0 {
+			c.warnKeptRestrictions(runaiConfig, state, restrictScheduling, restrictRunaiSystem)
+		}
+		if restrictRunaiSystem || state.taintedRoles[systemWorkerLabel] {
+			if err := setDeploymentAffinity(c.client, common.RunaiNamespace, common.RunaiOperatorDeploymentName, restrictRunaiSystem, state.taintedRoles, nil); err != nil {
+				c.recorder.Eventf(runaiConfig, v1.EventTypeWarning, eventNodeAffinityFailed, "Failed to update the affinity of %s: %v", common.RunaiOperatorDeploymentName, err)
+				return err
+			}
+		}
+
+		allRoles := nodeRoleTypes{GpuWorker: true, CpuWorker: true, RunaiSystemWorker: true}
+		newValues := desiredNodeAffinity(allRoles, oldValues, restrictScheduling, restrictRunaiSystem)
+		oldTolerations, _, _ := unstructured.NestedSlice(runaiConfig.Object, "spec", "global", "tolerations")
+		// only the tolerations of the tainted roles are passed, so that none is removed
+		var taintedLabels []string
+		for _, label := range []string{gpuWorkerLabel, cpuWorkerLabel, systemWorkerLabel} {
+			if state.taintedRoles[label] {
+				taintedLabels = append(taintedLabels, label)
+			}
+		}
+		tolerations := desiredConfigTolerations(oldTolerations, taintedLabels, state.taintedRoles)
+		if reflect.DeepEqual(oldValues, newValues) && tolerationsEqual(oldTolerations, tolerations) {
+			c.restrictions = &state
+			return nil
+		}
+
+		if err = unstructured.SetNestedMap(runaiConfig.Object, newValues, "spec", "global", "nodeAffinity"); err != nil {
+			return err
+		}
+		if len(tolerations) > 0 {
+			if err = unstructured.SetNestedSlice(runaiConfig.Object, tolerations, "spec", "global", "tolerations"); err != nil {
+				return err
+			}
+		}
+		_, err = runaiConfigs.Update(runaiConfig, metav1.UpdateOptions{})
+		if err == nil {
+			message := fmt.Sprintf("Set restrictScheduling to %v and restrictRunaiSystem to %v by the roles of the nodes", restrictScheduling, restrictRunaiSystem)
+			if len(taintedLabels) > 0 {
+				message += fmt.Sprintf(", with the tolerations of the taints of %s", strings.Join(taintedLabels, ", "))
+			}
+			log.Info(message)
+			c.recorder.Event(runaiConfig, v1.EventTypeNormal, eventNodeAffinityChanged, message)
+			c.restrictions = &state
+			return nil
+		}
+		log.Debugf("Failed to update runaiconfig, attempt: %v, error: %v", i, err)
+	}
+	if runaiConfig, getErr := runaiConfigs.Get(common.RunaiConfigName, metav1.GetOptions{}); getErr == nil {
+		c.recorder.Eventf(runaiConfig, v1.EventTypeWarning, eventNodeAffinityFailed, "Failed to update the nodeAffinity flags: %v", err)
+	}
+	return err
+}
+
+// warnKeptRestrictions emits a Warning event for the restrictions that are on while no node has their roles
+func (c *nodeRoleController) warnKeptRestrictions(runaiConfig *unstructured.Unstructured, state restrictionState, restrictScheduling, restrictRunaiSystem bool) {
+	if restrictScheduling && !state.restrictScheduling {
+		c.recorder.Event(runaiConfig, v1.EventTypeWarning, eventRestrictionKept,
+			"No node has a worker role, restrictScheduling is kept on and workloads cannot be scheduled until a node gets one. Run 'runai-adm remove node-role' to turn it off")
+	}
+	if restrictRunaiSystem && !state.restrictRunaiSystem {
+		c.recorder.Event(runaiConfig, v1.EventTypeWarning, eventRestrictionKept,
+			"No node has the runai-system role, restrictRunaiSystem is kept on and the Run:AI system pods cannot be scheduled until a node gets it. Run 'runai-adm remove node-role' to turn it off")
+	}
+}
+
+func (c *nodeRoleController) ruleRoles() []string {
+	var roles []string
+	for label := range c.rules {
+		roles = append(roles, strings.TrimPrefix(label, "node-role.kubernetes.io/"))
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func stopOnSignal() <-chan struct{} {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+	return stop
+}
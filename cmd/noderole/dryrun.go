@@ -0,0 +1,192 @@
+package noderole
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// printNodeRolePlan prints what updateRunaiConfigurations would change for nodes that already have their new labels,
+// using the same decisions without changing anything
+func printNodeRolePlan(client *client.Client, flags nodeRoleTypes, nodesInCluster map[string]v1.Node, withBackend bool) {
+	nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist := nodeRolesExist(nodesInCluster)
+
+	fmt.Println("\n=== RunaiConfig nodeAffinity and tolerations")
+	taintedRoles := roleTaintsExist(nodesInCluster)
+	var backend backendRelease
+	if withBackend {
+		backend = detectBackendOrExit(client)
+	}
+	printNodeAffinityPlan(client, flags, nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist, taintedRoles)
+
+	if flags.RunaiSystemWorker {
+		fmt.Println("=== Operator affinity")
+		affinity := "none"
+		if nodeWithRestrictRunaiSystemExist {
+			affinity = "requires " + systemWorkerLabel
+		}
+		if taintedRoles[systemWorkerLabel] {
+			taint := roleTaint(systemWorkerLabel)
+			affinity += ", tolerates " + taint.ToString()
+		}
+		fmt.Printf("deployment/%s: %s\n", common.RunaiOperatorDeploymentName, affinity)
+		if withBackend {
+			if namespace, name, found := backend.operator(); found {
+				fmt.Printf("deployment/%s (namespace %s): %s\n", name, namespace, affinity)
+			}
+		}
+		fmt.Println()
+
+		if withBackend {
+			fmt.Printf("=== Backend nodeAffinity values (%s)\n", backend.describe())
+			printBackendValuesPlan(client, backend, nodeWithRestrictRunaiSystemExist)
+		}
+	}
+
+	if flags.NoEvict {
+		fmt.Printf("=== Resources to move\nnone, --no-evict is set\n\n")
+		return
+	}
+	printResourcesPlan(client, flags, nodesInCluster, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist, true, common.RunaiNamespace)
+	if withBackend {
+		if _, isHelm3 := backend.(*helm3Backend); isHelm3 {
+			fmt.Printf("=== Resources to move in namespace %s\nnone, the Helm 3 release has to be upgraded\n\n", common.RunaiBackendNamespace)
+			return
+		}
+		printResourcesPlan(client, flags, nodesInCluster, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist, false, common.RunaiBackendNamespace)
+	}
+}
+
+func printBackendValuesPlan(client *client.Client, backend backendRelease, nodeWithRestrictRunaiSystemExist bool) {
+	values, err := backend.values(client)
+	if err != nil {
+		fmt.Printf("Failed to get the values of the %s: %v\n\n", backend.describe(), err)
+		return
+	}
+	oldValue, found, _ := unstructured.NestedFieldNoCopy(values, "global", "nodeAffinity", "restrictRunaiSystem")
+	switch {
+	case !found:
+		fmt.Printf("    + restrictRunaiSystem: %v\n", nodeWithRestrictRunaiSystemExist)
+	case oldValue != nodeWithRestrictRunaiSystemExist:
+		fmt.Printf("    ~ restrictRunaiSystem: %v -> %v\n", oldValue, nodeWithRestrictRunaiSystemExist)
+	default:
+		fmt.Printf("unchanged restrictRunaiSystem: %v\n", oldValue)
+	}
+	fmt.Println()
+}
+
+func printNodeAffinityPlan(client *client.Client, flags nodeRoleTypes, nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist bool, taintedRoles map[string]bool) {
+	runaiConfig, err := client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Get(common.RunaiConfigName, metav1.GetOptions{})
+	if err != nil {
+		fmt.Printf("Failed to get RunaiConfig, Run:AI is not installed on the cluster\n\n")
+		return
+	}
+	oldValues, _, _ := unstructured.NestedMap(runaiConfig.Object, "spec", "global", "nodeAffinity")
+	newValues := desiredNodeAffinity(flags, oldValues, nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist)
+
+	var keys []string
+	for key := range newValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		oldValue, found := oldValues[key]
+		switch {
+		case !found:
+			fmt.Printf("    + %s: %v\n", key, newValues[key])
+		case fmt.Sprint(oldValue) != fmt.Sprint(newValues[key]):
+			fmt.Printf("    ~ %s: %v -> %v\n", key, oldValue, newValues[key])
+		default:
+			fmt.Printf("unchanged %s: %v\n", key, oldValue)
+		}
+	}
+
+	oldTolerations, _, _ := unstructured.NestedSlice(runaiConfig.Object, "spec", "global", "tolerations")
+	newTolerations := desiredConfigTolerations(oldTolerations, roleLabels(flags), taintedRoles)
+	for _, label := range roleLabels(flags) {
+		taint := roleTaint(label)
+		hadToleration := false
+		for _, toleration := range oldTolerations {
+			if values, ok := toleration.(map[string]interface{}); ok && values["key"] == taint.Key {
+				hadToleration = true
+			}
+		}
+		switch {
+		case taintedRoles[label] && !hadToleration:
+			fmt.Printf("    + toleration %s\n", taint.ToString())
+		case !taintedRoles[label] && hadToleration:
+			fmt.Printf("    - toleration %s\n", taint.ToString())
+		}
+	}
+	if tolerationsEqual(oldTolerations, newTolerations) {
+		fmt.Println("unchanged tolerations")
+	}
+	fmt.Println()
+}
+
+// printResourcesPlan prints the resources deleteResourcesIfNeeded would delete or evict in a namespace
+func printResourcesPlan(client *client.Client, flags nodeRoleTypes, nodesInCluster map[string]v1.Node, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist, deleteStsAndPvc bool, namespace string) {
+	fmt.Printf("=== Resources to move in namespace %s\n", namespace)
+	moving := 0
+	evicted := map[string]bool{}
+	if deleteStsAndPvc {
+		deleteStatefulSets, deletePvc := planDbVolumeMove(flags, client, nodesInCluster, nodeWithRestrictRunaiSystemExist, namespace)
+		if deleteStatefulSets {
+			stsList, err := client.GetClientset().AppsV1().StatefulSets(namespace).List(metav1.ListOptions{})
+			if err != nil {
+				log.Debugf("Failed to list statefulsets in the %s namespace", namespace)
+			} else {
+				for _, sts := range stsList.Items {
+					fmt.Printf("recreate StatefulSet/%s\n", sts.Name)
+					for _, pod := range statefulSetPods(client, sts) {
+						fmt.Printf("evict Pod/%s (node %s)\n", pod.Name, pod.Spec.NodeName)
+						evicted[pod.Name] = true
+					}
+					moving++
+				}
+			}
+		}
+		if deletePvc {
+			fmt.Printf("delete PersistentVolumeClaim/%s (volume on node %s, which is not a system node)\n", runaiDbPvcName, dbPvcNode(client, namespace))
+			moving++
+		}
+	}
+
+	jobs, err := client.GetClientset().BatchV1().Jobs(namespace).List(metav1.ListOptions{})
+	if err == nil {
+		for _, job := range jobs.Items {
+			fmt.Printf("delete Job/%s\n", job.Name)
+			moving++
+		}
+	}
+
+	if flags.RunaiSystemWorker || flags.CpuWorker || flags.GpuWorker {
+		pods, err := client.GetClientset().CoreV1().Pods(namespace).List(metav1.ListOptions{})
+		if err == nil {
+			for _, pod := range pods.Items {
+				if !evicted[pod.Name] && podNeedsToMove(pod, nodesInCluster, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist) {
+					fmt.Printf("evict Pod/%s (node %s)\n", pod.Name, pod.Spec.NodeName)
+					moving++
+				}
+			}
+		}
+	}
+	if moving == 0 {
+		fmt.Println("none")
+	}
+	fmt.Println()
+}
+
+func dbPvcNode(client *client.Client, namespace string) string {
+	pvc, err := client.GetClientset().CoreV1().PersistentVolumeClaims(namespace).Get(runaiDbPvcName, metav1.GetOptions{})
+	if err != nil {
+		return "unknown"
+	}
+	return pvc.Annotations[selectedNodeAnnotation]
+}
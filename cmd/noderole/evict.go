@@ -0,0 +1,78 @@
+package noderole
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultEvictionTimeout = 5 * time.Minute
+
+	evictionRetryInterval = 5 * time.Second
+)
+
+// evictPods evicts the pods one after the other through the Eviction API, so that PodDisruptionBudgets are respected,
+// and waits for every pod to be gone before evicting the next one. A pod that cannot be evicted within the eviction
+// timeout is reported and skipped.
+func evictPods(client *client.Client, flags nodeRoleTypes, pods []v1.Pod) {
+	for i, pod := range pods {
+		log.Infof("[%d/%d] Evicting pod %s/%s from node %s", i+1, len(pods), pod.Namespace, pod.Name, pod.Spec.NodeName)
+		if err := evictPod(client, flags, pod); err != nil {
+			log.Infof("[%d/%d] Failed to evict pod %s/%s, error: %v", i+1, len(pods), pod.Namespace, pod.Name, err)
+			continue
+		}
+		log.Infof("[%d/%d] Evicted pod %s/%s", i+1, len(pods), pod.Namespace, pod.Name)
+	}
+}
+
+func evictPod(client *client.Client, flags nodeRoleTypes, pod v1.Pod) error {
+	eviction := &policyv1beta1.Eviction{
+		ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{},
+	}
+	if flags.GracePeriod >= 0 {
+		gracePeriod := int64(flags.GracePeriod)
+		eviction.DeleteOptions.GracePeriodSeconds = &gracePeriod
+	}
+
+	deadline := time.Now().Add(flags.EvictionTimeout)
+	for {
+		err := client.GetClientset().CoreV1().Pods(pod.Namespace).Evict(eviction)
+		if err == nil || apierrors.IsNotFound(err) {
+			break
+		}
+		if !apierrors.IsTooManyRequests(err) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("eviction is still disallowed by a PodDisruptionBudget after %v", flags.EvictionTimeout)
+		}
+		log.Debugf("Eviction of pod %s/%s is disallowed by a PodDisruptionBudget, retrying: %v", pod.Namespace, pod.Name, err)
+		time.Sleep(evictionRetryInterval)
+	}
+	return waitForPodDeletion(client, pod, deadline)
+}
+
+// waitForPodDeletion waits until the pod is gone or was replaced by a new pod with the same name
+func waitForPodDeletion(client *client.Client, pod v1.Pod, deadline time.Time) error {
+	for {
+		current, err := client.GetClientset().CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) || (err == nil && current.UID != pod.UID) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("pod is still terminating")
+		}
+		time.Sleep(evictionRetryInterval)
+	}
+}
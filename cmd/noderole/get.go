@@ -0,0 +1,179 @@
+package noderole
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const gpuResourceName = v1.ResourceName("nvidia.com/gpu")
+
+type nodeRoleStatus struct {
+	Name        string `json:"name"`
+	GpuWorker   bool   `json:"gpuWorker"`
+	CpuWorker   bool   `json:"cpuWorker"`
+	RunaiSystem bool   `json:"runaiSystem"`
+	GpuCapacity int64  `json:"gpuCapacity"`
+	Ready       bool   `json:"ready"`
+	Schedulable bool   `json:"schedulable"`
+	RunaiPods   int    `json:"runaiPods"`
+}
+
+// nodeRoles is the output of get node-roles. The RunaiConfig flags are nil when they are not set.
+type nodeRoles struct {
+	RestrictScheduling  *bool            `json:"restrictScheduling"`
+	RestrictRunaiSystem *bool            `json:"restrictRunaiSystem"`
+	Nodes               []nodeRoleStatus `json:"nodes"`
+}
+
+func Get() *cobra.Command {
+	output := ""
+	var command = &cobra.Command{
+		Use:     "node-roles",
+		Aliases: []string{"node-role"},
+		Short:   "Get the Run:AI roles of the nodes",
+		Args:    cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			roles, err := getNodeRoles(client.GetClient())
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			if err := printStatus(roles, output, func() { printNodeRolesTable(roles) }); err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	command.Flags().StringVarP(&output, "output", "o", "", "Output format, one of: json, yaml")
+	return command
+}
+
+func getNodeRoles(client *client.Client) (*nodeRoles, error) {
+	nodes, err := client.GetClientset().CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	podsPerNode, err := countRunaiPodsPerNode(client)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := &nodeRoles{}
+	roles.RestrictScheduling, roles.RestrictRunaiSystem = getNodeAffinityFlags(client)
+	for _, node := range nodes.Items {
+		_, gpuWorker := node.Labels[gpuWorkerLabel]
+		_, cpuWorker := node.Labels[cpuWorkerLabel]
+		_, runaiSystem := node.Labels[systemWorkerLabel]
+		gpus := node.Status.Capacity[gpuResourceName]
+		roles.Nodes = append(roles.Nodes, nodeRoleStatus{
+			Name:        node.Name,
+			GpuWorker:   gpuWorker,
+			CpuWorker:   cpuWorker,
+			RunaiSystem: runaiSystem,
+			GpuCapacity: gpus.Value(),
+			Ready:       isNodeReady(&node),
+			Schedulable: !node.Spec.Unschedulable,
+			RunaiPods:   podsPerNode[node.Name],
+		})
+	}
+	sort.Slice(roles.Nodes, func(i, j int) bool {
+		return roles.Nodes[i].Name < roles.Nodes[j].Name
+	})
+	return roles, nil
+}
+
+// countRunaiPodsPerNode counts the pods of the runai namespace that are not done, by the node they run on
+func countRunaiPodsPerNode(client *client.Client) (map[string]int, error) {
+	pods, err := client.GetClientset().CoreV1().Pods(common.RunaiNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in the %s namespace: %v", common.RunaiNamespace, err)
+	}
+	podsPerNode := map[string]int{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		podsPerNode[pod.Spec.NodeName]++
+	}
+	return podsPerNode, nil
+}
+
+// getNodeAffinityFlags reads restrictScheduling and restrictRunaiSystem from the RunaiConfig
+func getNodeAffinityFlags(client *client.Client) (restrictScheduling, restrictRunaiSystem *bool) {
+	runaiConfig, err := client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Get(common.RunaiConfigName, metav1.GetOptions{})
+	if err != nil {
+		log.Debugf("Failed to get RunaiConfig: %v", err)
+		return nil, nil
+	}
+	if value, found, _ := unstructured.NestedBool(runaiConfig.Object, "spec", "global", "nodeAffinity", "restrictScheduling"); found {
+		restrictScheduling = &value
+	}
+	if value, found, _ := unstructured.NestedBool(runaiConfig.Object, "spec", "global", "nodeAffinity", "restrictRunaiSystem"); found {
+		restrictRunaiSystem = &value
+	}
+	return restrictScheduling, restrictRunaiSystem
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// printStatus prints the status as json or yaml, or as a table by default
+func printStatus(status interface{}, output string, printTable func()) error {
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(status)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case "":
+		printTable()
+	default:
+		return fmt.Errorf("unknown output format %s, supported formats are: json, yaml", output)
+	}
+	return nil
+}
+
+func printNodeRolesTable(roles *nodeRoles) {
+	fmt.Printf("restrictScheduling: %s\n", formatFlag(roles.RestrictScheduling))
+	fmt.Printf("restrictRunaiSystem: %s\n\n", formatFlag(roles.RestrictRunaiSystem))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "NODE\tGPU-WORKER\tCPU-WORKER\tRUNAI-SYSTEM\tGPUS\tREADY\tSCHEDULABLE\tRUNAI-PODS\n")
+	for _, node := range roles.Nodes {
+		fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%d\t%v\t%v\t%d\n", node.Name, node.GpuWorker, node.CpuWorker, node.RunaiSystem, node.GpuCapacity, node.Ready, node.Schedulable, node.RunaiPods)
+	}
+	w.Flush()
+}
+
+func formatFlag(value *bool) string {
+	if value == nil {
+		return "not set"
+	}
+	return fmt.Sprint(*value)
+}
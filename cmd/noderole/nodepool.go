@@ -0,0 +1,367 @@
+package noderole
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/cmd/lock"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const nodePoolLabel = "runai/node-pool"
+
+type nodePoolStatus struct {
+	Name           string   `json:"name"`
+	Registered     bool     `json:"registered"`
+	Nodes          []string `json:"nodes"`
+	ReadyNodes     int      `json:"readyNodes"`
+	GpuCapacity    int64    `json:"gpuCapacity"`
+	GpuAllocatable int64    `json:"gpuAllocatable"`
+}
+
+func SetNodePool() *cobra.Command {
+	flags := nodeRoleTypes{}
+	var nodes []string
+	var command = &cobra.Command{
+		Use:         "node-pool NAME [NODE_NAME...]",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Aliases:     []string{"node-pools"},
+		Short:       "Add nodes to a named node pool and register the pool in the RunaiConfig",
+		Args:        cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pool, patterns := args[0], append(args[1:], nodes...)
+			if errs := validation.IsDNS1123Label(pool); len(errs) > 0 {
+				fmt.Printf("Invalid node pool name %s: %s\n", pool, strings.Join(errs, ", "))
+				os.Exit(1)
+			}
+			if !hasNodeTargets(flags, patterns) {
+				fmt.Println("No nodes were selected")
+				cmd.HelpFunc()(cmd, args)
+				os.Exit(1)
+			}
+			client := client.GetClient()
+			j := beginJournal(client, flags, "set node-pool")
+			nodesInCluster, sourcePools, failed := labelNodesWithPool(client, flags, patterns, pool, j)
+			j.Step("register-node-pool", func() {
+				updateNodePoolRegistration(client, pool, true, j)
+			})
+			members := nodePoolMembers(nodesInCluster)
+			for _, source := range sourcePools {
+				if len(members[source]) == 0 {
+					// the move took the last nodes of the pool
+					j.Step("unregister-node-pool-"+source, func() {
+						updateNodePoolRegistration(client, source, false, j)
+					})
+				}
+			}
+			exitOnFailedNodes(failed, j)
+			j.Finish()
+
+			log.Infof("Successfully added the nodes to node pool %s", pool)
+		},
+	}
+
+	command.Flags().StringSliceVar(&nodes, "nodes", nil, "Names or patterns of the nodes to add to the pool, comma separated")
+	command.Flags().BoolVar(&flags.AllNodes, "all", false, "Add all nodes to the pool")
+	addNodeTargetFlags(command, &flags)
+	addParallelismFlag(command, &flags)
+	return command
+}
+
+func RemoveNodePool() *cobra.Command {
+	flags := nodeRoleTypes{}
+	var nodes []string
+	var command = &cobra.Command{
+		Use:         "node-pool NAME [NODE_NAME...]",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Aliases:     []string{"node-pools"},
+		Short:       "Remove nodes from a node pool, the pool is unregistered from the RunaiConfig when it has no nodes left, also when it had none",
+		Args:        cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pool, patterns := args[0], append(args[1:], nodes...)
+			// only nodes of the pool are selected, all of them when no nodes are given
+			poolSelector := nodePoolLabel + "=" + pool
+			if flags.Selector != "" {
+				poolSelector = flags.Selector + "," + poolSelector
+			}
+			flags.Selector = poolSelector
+			client := client.GetClient()
+			j := beginJournal(client, flags, "remove node-pool")
+			nodesInCluster, _, failed := labelNodesWithPool(client, flags, patterns, "", j)
+			if len(nodePoolMembers(nodesInCluster)[pool]) == 0 {
+				j.Step("unregister-node-pool", func() {
+					updateNodePoolRegistration(client, pool, false, j)
+				})
+			}
+			exitOnFailedNodes(failed, j)
+			j.Finish()
+
+			log.Infof("Successfully removed the nodes from node pool %s", pool)
+		},
+	}
+
+	command.Flags().StringSliceVar(&nodes, "nodes", nil, "Names or patterns of the nodes to remove from the pool, comma separated. All the nodes of the pool when no nodes are selected")
+	addNodeTargetFlags(command, &flags)
+	addParallelismFlag(command, &flags)
+	return command
+}
+
+func GetNodePools() *cobra.Command {
+	output := ""
+	var command = &cobra.Command{
+		Use:     "node-pools",
+		Aliases: []string{"node-pool"},
+		Short:   "Get the node pools with their nodes and GPUs",
+		Args:    cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			pools, err := getNodePools(client.GetClient())
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			if err := printStatus(pools, output, func() { printNodePoolsTable(pools) }); err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	command.Flags().StringVarP(&output, "output", "o", "", "Output format, one of: json, yaml")
+	return command
+}
+
+// labelNodesWithPool sets the pool label of the selected nodes to pool, or removes it when pool is empty.
+// A node is in a single pool, so a node of another pool is moved. It returns the nodes in the cluster, with the
+// updated ones, the pools the nodes were moved from, and the number of nodes that failed to update.
+// Removing the pool of no nodes is not an error, so that remove node-pool can unregister an empty pool.
+func labelNodesWithPool(client *client.Client, flags nodeRoleTypes, patterns []string, pool string, j *journal.Journal) (map[string]v1.Node, []string, int) {
+	log.Info("Updating nodes with node pool")
+	targets, err := newNodeTargets(flags, patterns)
+	if err != nil {
+		fmt.Println(err)
+		j.Finish()
+		os.Exit(1)
+	}
+
+	nodeList, err := client.GetClientset().CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil || len(nodeList.Items) == 0 {
+		fmt.Println("Failed to list nodes in cluster")
+		j.Finish()
+		os.Exit(1)
+	}
+
+	nodesInCluster := map[string]v1.Node{}
+	wasAnyNodeUpdated := false
+	var updates []nodeLabelUpdate
+	sources := map[string]bool{}
+	for _, nodeInfo := range nodeList.Items {
+		if targets.matches(&nodeInfo) {
+			current, found := nodeInfo.Labels[nodePoolLabel]
+			if current != pool || (found && pool == "") {
+				if found && pool != "" {
+					log.Infof("Moving node %s from node pool %s to %s", nodeInfo.Name, current, pool)
+					sources[current] = true
+				}
+				j.RecordNodeLabels(&nodeInfo, []string{nodePoolLabel})
+				updates = append(updates, nodePoolLabelUpdate(nodeInfo, pool))
+			}
+			wasAnyNodeUpdated = true
+		}
+		nodesInCluster[nodeInfo.Name] = nodeInfo
+	}
+
+	for _, pattern := range targets.unmatchedPatterns() {
+		log.Infof("Node: %v was not found in cluster", pattern)
+	}
+	if !wasAnyNodeUpdated && pool != "" {
+		log.Infof("No nodes were updated")
+		j.Finish()
+		os.Exit(1)
+	}
+	if !wasAnyNodeUpdated {
+		log.Infof("No nodes of the node pool were selected")
+	}
+
+	// a resumed run finds the nodes already moved, so it uses the pools recorded by the first run
+	var sourcePools []string
+	for source := range sources {
+		sourcePools = append(sourcePools, source)
+	}
+	sort.Strings(sourcePools)
+	recorded, err := j.Value("sourceNodePools", func() (string, error) {
+		return strings.Join(sourcePools, ","), nil
+	})
+	if err != nil {
+		log.Infof("Failed to update the journal, error: %v", err)
+		os.Exit(1)
+	}
+	sourcePools = nil
+	if recorded != "" {
+		sourcePools = strings.Split(recorded, ",")
+	}
+
+	failed := updateNodesAndPrintSummary(client, updates, flags.Parallelism, nodesInCluster)
+	return nodesInCluster, sourcePools, failed
+}
+
+func nodePoolLabelUpdate(nodeInfo v1.Node, pool string) nodeLabelUpdate {
+	if pool == "" {
+		return nodeLabelUpdate{node: nodeInfo, labelsToRemove: []string{nodePoolLabel}}
+	}
+	return nodeLabelUpdate{node: nodeInfo, labelsToSet: map[string]string{nodePoolLabel: pool}}
+}
+
+// updateNodePoolRegistration adds the pool to, or removes it from, spec.global.nodePools of the RunaiConfig,
+// where the scheduler and the projects reference it by name
+func updateNodePoolRegistration(client *client.Client, pool string, register bool, j *journal.Journal) {
+	var err error
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		var runaiConfig *unstructured.Unstructured
+		runaiConfig, err = client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Get(common.RunaiConfigName, metav1.GetOptions{})
+		if err != nil {
+			fmt.Println("Failed to get RunaiConfig, Run:AI is not installed on the cluster")
+			os.Exit(1)
+		}
+		pools, _, _ := unstructured.NestedSlice(runaiConfig.Object, "spec", "global", "nodePools")
+		if isNodePoolRegistered(pools, pool) == register {
+			return
+		}
+		j.RecordObjectSpec(common.RunaiConfigResource, runaiConfig)
+
+		var newPools []interface{}
+		for _, registered := range pools {
+			if nodePoolName(registered) != pool {
+				newPools = append(newPools, registered)
+			}
+		}
+		if register {
+			newPools = append(newPools, map[string]interface{}{
+				"name":         pool,
+				"nodeSelector": map[string]interface{}{nodePoolLabel: pool},
+			})
+		}
+		if len(newPools) > 0 {
+			err = unstructured.SetNestedSlice(runaiConfig.Object, newPools, "spec", "global", "nodePools")
+			if err != nil {
+				break
+			}
+		} else {
+			unstructured.RemoveNestedField(runaiConfig.Object, "spec", "global", "nodePools")
+		}
+		_, err = client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Update(runaiConfig, metav1.UpdateOptions{})
+		if err == nil {
+			break
+		}
+		log.Debugf("Failed to update runaiconfig, attempt: %v, error: %v", i, err)
+	}
+	if err != nil {
+		log.Infof("Failed to update runaiconfig, error: %v", err)
+		os.Exit(1)
+	}
+	if register {
+		log.Infof("Registered node pool %s in the RunaiConfig", pool)
+	} else {
+		log.Infof("Unregistered node pool %s from the RunaiConfig", pool)
+	}
+}
+
+func isNodePoolRegistered(pools []interface{}, pool string) bool {
+	for _, registered := range pools {
+		if nodePoolName(registered) == pool {
+			return true
+		}
+	}
+	return false
+}
+
+func nodePoolName(registered interface{}) string {
+	values, ok := registered.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := values["name"].(string)
+	return name
+}
+
+// nodePoolMembers returns the names of the nodes of every pool
+func nodePoolMembers(nodesInCluster map[string]v1.Node) map[string][]string {
+	members := map[string][]string{}
+	for _, nodeInfo := range nodesInCluster {
+		if pool, found := nodeInfo.Labels[nodePoolLabel]; found {
+			members[pool] = append(members[pool], nodeInfo.Name)
+		}
+	}
+	return members
+}
+
+func getNodePools(client *client.Client) ([]nodePoolStatus, error) {
+	nodes, err := client.GetClientset().CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+
+	pools := map[string]*nodePoolStatus{}
+	poolStatus := func(name string) *nodePoolStatus {
+		if _, found := pools[name]; !found {
+			pools[name] = &nodePoolStatus{Name: name, Nodes: []string{}}
+		}
+		return pools[name]
+	}
+	for _, node := range nodes.Items {
+		name, found := node.Labels[nodePoolLabel]
+		if !found {
+			continue
+		}
+		status := poolStatus(name)
+		status.Nodes = append(status.Nodes, node.Name)
+		if isNodeReady(&node) {
+			status.ReadyNodes++
+		}
+		capacity := node.Status.Capacity[gpuResourceName]
+		allocatable := node.Status.Allocatable[gpuResourceName]
+		status.GpuCapacity += capacity.Value()
+		status.GpuAllocatable += allocatable.Value()
+	}
+
+	runaiConfig, err := client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Get(common.RunaiConfigName, metav1.GetOptions{})
+	if err != nil {
+		log.Debugf("Failed to get RunaiConfig: %v", err)
+	} else {
+		registered, _, _ := unstructured.NestedSlice(runaiConfig.Object, "spec", "global", "nodePools")
+		for _, pool := range registered {
+			if name := nodePoolName(pool); name != "" {
+				poolStatus(name).Registered = true
+			}
+		}
+	}
+
+	var result []nodePoolStatus
+	for _, status := range pools {
+		sort.Strings(status.Nodes)
+		result = append(result, *status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func printNodePoolsTable(pools []nodePoolStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "POOL\tREGISTERED\tNODES\tREADY\tGPUS\tALLOCATABLE-GPUS\n")
+	for _, pool := range pools {
+		fmt.Fprintf(w, "%s\t%v\t%d\t%d\t%d\t%d\n", pool.Name, pool.Registered, len(pool.Nodes), pool.ReadyNodes, pool.GpuCapacity, pool.GpuAllocatable)
+	}
+	w.Flush()
+}
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"time"
 
 	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/cmd/lock"
 	"github.com/run-ai/runai-cli/pkg/client"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -21,30 +24,67 @@ type nodeRoleTypes struct {
 	AllNodes          bool
 	GpuWorker         bool
 	RunaiSystemWorker bool
+	Selector          string
+	FromFile          string
+	NoEvict           bool
+	DryRun            bool
+	Taint             bool
+	Force             bool
+	MinSystemNodes    int
+	Parallelism       int
+	GracePeriod       int
+	EvictionTimeout   time.Duration
 }
 
 const (
 	gpuWorkerLabel    = "node-role.kubernetes.io/runai-gpu-worker"
 	cpuWorkerLabel    = "node-role.kubernetes.io/runai-cpu-worker"
 	systemWorkerLabel = "node-role.kubernetes.io/runai-system"
+
+	runaiDbPvcName         = "data-runai-db-0"
+	selectedNodeAnnotation = "volume.kubernetes.io/selected-node"
 )
 
 func Set() *cobra.Command {
 	flags := nodeRoleTypes{}
 	withBackend := false
+	auto := false
+	yes := false
 	var command = &cobra.Command{
-		Use:     "node-role NODE_NAME",
-		Aliases: []string{"node-roles"},
-		Short:   "Set node with roles",
+		Use:         "node-role [NODE_NAME...]",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Aliases:     []string{"node-roles"},
+		Short:       "Set node with roles",
 		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) == 0 && !flags.AllNodes {
+			if auto {
+				if flags.CpuWorker || flags.GpuWorker || flags.RunaiSystemWorker {
+					fmt.Println("--auto detects the worker roles and cannot be used together with role flags")
+					os.Exit(1)
+				}
+				client := client.GetClient()
+				j := beginJournal(client, flags, "set node-role")
+				setDetectedNodeRoles(client, flags, args, withBackend, yes, j)
+				j.Finish()
+				if !flags.DryRun {
+					log.Info("Successfully updated nodes and set configurations")
+				}
+				return
+			}
+			if !hasNodeTargets(flags, args) {
 				fmt.Println("No nodes were selected")
 				cmd.HelpFunc()(cmd, args)
 				os.Exit(1)
 			}
 			client := client.GetClient()
-			nodesInCluster := labelNodesWithRolesAndGetNodesInCluster(client, flags, args, true)
-			updateRunaiConfigurations(client, flags, nodesInCluster, withBackend)
+			j := beginJournal(client, flags, "set node-role")
+			nodesInCluster, failed := labelNodesWithRolesAndGetNodesInCluster(client, flags, args, true, j)
+			if flags.DryRun {
+				printNodeRolePlan(client, flags, nodesInCluster, withBackend)
+				return
+			}
+			updateRunaiConfigurations(client, flags, nodesInCluster, withBackend, j)
+			exitOnFailedNodes(failed, j)
+			j.Finish()
 
 			log.Info("Successfully updated nodes and set configurations")
 		},
@@ -55,9 +95,28 @@ func Set() *cobra.Command {
 	command.Flags().BoolVar(&flags.CpuWorker, "cpu-worker", false, "Set nodes with node-role of CPU Worker.")
 	command.Flags().BoolVar(&flags.GpuWorker, "gpu-worker", false, "Set nodes with node-role of GPU Worker.")
 	command.Flags().BoolVar(&flags.RunaiSystemWorker, "runai-system-worker", false, "Set nodes with node-role of Run:AI System Worker.")
+	command.Flags().BoolVar(&auto, "auto", false, "Detect GPU and CPU workers by their NVIDIA GPUs, on all nodes or on the selected ones, skipping control-plane nodes.")
+	command.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation of the detected roles.")
+	command.Flags().BoolVar(&flags.Taint, "taint", false, "Also taint the nodes with the NoSchedule taints of their roles (e.g. runai/system=true:NoSchedule) to keep other workloads off them")
+	addNodeTargetFlags(command, &flags)
+	addEvictionFlags(command, &flags)
+	addSafetyFlags(command, &flags)
+	addParallelismFlag(command, &flags)
+	command.Flags().BoolVar(&flags.DryRun, "dry-run", false, "Print the label changes and the Run:AI pods, StatefulSets and PVCs that would be moved without changing anything")
 	return command
 }
 
+func addNodeTargetFlags(command *cobra.Command, flags *nodeRoleTypes) {
+	command.Flags().StringVarP(&flags.Selector, "selector", "l", "", "Select nodes by a label selector (e.g. nvidia.com/gpu.product=A100), combined with the node names if any are given")
+	command.Flags().StringVar(&flags.FromFile, "from-file", "", "Read node names from a file, one per line")
+}
+
+func addEvictionFlags(command *cobra.Command, flags *nodeRoleTypes) {
+	command.Flags().BoolVar(&flags.NoEvict, "no-evict", false, "Only update the node labels and the Run:AI configurations, without moving Run:AI pods off nodes that lost their role")
+	command.Flags().IntVar(&flags.GracePeriod, "grace-period", -1, "Seconds given to each evicted pod to terminate, negative to use the grace period of the pod")
+	command.Flags().DurationVar(&flags.EvictionTimeout, "eviction-timeout", defaultEvictionTimeout, "Time to wait for each pod to be evicted, e.g. while a PodDisruptionBudget disallows the eviction")
+}
+
 func deletePodsIfNeeded(flags nodeRoleTypes, client *client.Client, nodesInCluster map[string]v1.Node, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist bool, namespace string) {
 	if !flags.RunaiSystemWorker && !flags.CpuWorker && !flags.GpuWorker {
 		return
@@ -68,47 +127,59 @@ func deletePodsIfNeeded(flags nodeRoleTypes, client *client.Client, nodesInClust
 		os.Exit(1)
 	}
 
+	var podsToEvict []v1.Pod
 	for _, pod := range runaiPods.Items {
-		deletePodIfNeeded(pod, nodesInCluster, client, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist, namespace)
+		if podNeedsToMove(pod, nodesInCluster, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist) {
+			podsToEvict = append(podsToEvict, pod)
+		}
 	}
+	evictPods(client, flags, podsToEvict)
 }
 
-func deletePodIfNeeded(pod v1.Pod, nodesInCluster map[string]v1.Node, client *client.Client, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist bool, namespace string) {
+// podNeedsToMove checks whether the pod runs on a node without a role label its node affinity requires.
+// The first role label of the affinity that the node satisfies ends the check.
+func podNeedsToMove(pod v1.Pod, nodesInCluster map[string]v1.Node, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist bool) bool {
 	if pod.Spec.Affinity == nil || pod.Spec.Affinity.NodeAffinity == nil || pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil || pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms == nil {
-		return
+		return false
 	}
+	needsToMove := false
 	for _, nodeSelectorTerms := range pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
 		for _, matchExpressions := range nodeSelectorTerms.MatchExpressions {
-			if nodeWithRestrictRunaiSystemExist && checkIfLabelIsNotStatisfiedAndDeleteIfNeeded(pod, nodesInCluster, client, matchExpressions, systemWorkerLabel, namespace) {
-				return
-			}
-			if nodeWithRestrictSchedulingExist && checkIfLabelIsNotStatisfiedAndDeleteIfNeeded(pod, nodesInCluster, client, matchExpressions, cpuWorkerLabel, namespace) {
-				return
-			}
-			if nodeWithRestrictSchedulingExist && checkIfLabelIsNotStatisfiedAndDeleteIfNeeded(pod, nodesInCluster, client, matchExpressions, gpuWorkerLabel, namespace) {
-				return
+			for _, check := range []struct {
+				enabled bool
+				label   string
+			}{
+				{nodeWithRestrictRunaiSystemExist, systemWorkerLabel},
+				{nodeWithRestrictSchedulingExist, cpuWorkerLabel},
+				{nodeWithRestrictSchedulingExist, gpuWorkerLabel},
+			} {
+				if !check.enabled || matchExpressions.Key != check.label {
+					continue
+				}
+				if isLabelSatisfied(pod, nodesInCluster, check.label) {
+					return needsToMove
+				}
+				needsToMove = true
 			}
 		}
 	}
+	return needsToMove
 }
 
-func checkIfLabelIsNotStatisfiedAndDeleteIfNeeded(pod v1.Pod, nodesInCluster map[string]v1.Node, client *client.Client, matchExpressions v1.NodeSelectorRequirement, labelToCheck, namespace string) bool {
-	if matchExpressions.Key == labelToCheck {
-		if len(pod.Spec.NodeName) == 0 {
-			return true
-		}
-		_, found := nodesInCluster[pod.Spec.NodeName].Labels[labelToCheck]
-		if found {
-			return true
-		}
-		client.GetClientset().CoreV1().Pods(namespace).Delete(pod.Name, &metav1.DeleteOptions{})
-		log.Debugf("Deleted Run:AI pod: %v", pod.Name)
+func isLabelSatisfied(pod v1.Pod, nodesInCluster map[string]v1.Node, labelToCheck string) bool {
+	if len(pod.Spec.NodeName) == 0 {
+		return true
 	}
-	return false
+	_, found := nodesInCluster[pod.Spec.NodeName].Labels[labelToCheck]
+	return found
 }
 
 func deleteResourcesIfNeeded(flags nodeRoleTypes, client *client.Client, nodesInCluster map[string]v1.Node, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist, deleteStsAndPvc bool, namespace string) {
-	log.Info("Deleting old Run:AI resources")
+	if flags.NoEvict {
+		log.Infof("Not moving Run:AI resources, pods on nodes that lost their role keep running until they are rescheduled")
+		return
+	}
+	log.Info("Moving Run:AI resources")
 	if deleteStsAndPvc {
 		deletePVCAndStsIfNeeded(flags, client, nodesInCluster, nodeWithRestrictRunaiSystemExist, namespace)
 	}
@@ -120,7 +191,7 @@ func deleteJobsIfNeeded(client *client.Client, namespace string) {
 	jobs, err := client.GetClientset().BatchV1().Jobs(namespace).List(metav1.ListOptions{})
 	if err != nil {
 		fmt.Printf("Failed to list jobs, error: %v", err)
-		os.Exit(1)
+		journal.Exit()
 	}
 	for _, job := range jobs.Items {
 		client.GetClientset().BatchV1().Jobs(namespace).Delete(job.Name, &metav1.DeleteOptions{})
@@ -128,88 +199,179 @@ func deleteJobsIfNeeded(client *client.Client, namespace string) {
 	}
 }
 
+// deletePVCAndStsIfNeeded recreates the StatefulSets on the system nodes, together with the runai-db volume when it is
+// bound to a node that is not a system node. The StatefulSets are deleted without their pods, which are then evicted.
 func deletePVCAndStsIfNeeded(flags nodeRoleTypes, client *client.Client, nodesInCluster map[string]v1.Node, nodeWithRestrictRunaiSystemExist bool, namespace string) {
-	if !flags.RunaiSystemWorker || !nodeWithRestrictRunaiSystemExist {
+	deleteStatefulSets, deletePvc := planDbVolumeMove(flags, client, nodesInCluster, nodeWithRestrictRunaiSystemExist, namespace)
+	if !deleteStatefulSets {
+		return
+	}
+
+	stsList, err := client.GetClientset().AppsV1().StatefulSets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		log.Debugf("Failed to list statefulsets in the %s namespace", namespace)
 		return
 	}
 
-	pvc, err := client.GetClientset().CoreV1().PersistentVolumeClaims(namespace).Get("data-runai-db-0", metav1.GetOptions{})
-	pvcNode, found := pvc.Annotations["volume.kubernetes.io/selected-node"]
+	orphan := metav1.DeletePropagationOrphan
+	var podsToEvict []v1.Pod
+	for _, sts := range stsList.Items {
+		podsToEvict = append(podsToEvict, statefulSetPods(client, sts)...)
+		client.GetClientset().AppsV1().StatefulSets(namespace).Delete(sts.Name, &metav1.DeleteOptions{PropagationPolicy: &orphan})
+		log.Debugf("Deleted Statefulset: %v", sts.Name)
+	}
+	evictPods(client, flags, podsToEvict)
+
+	if deletePvc {
+		client.GetClientset().CoreV1().PersistentVolumeClaims(namespace).Delete(runaiDbPvcName, &metav1.DeleteOptions{})
+		log.Debugf("Deleted PVC %s", runaiDbPvcName)
+	}
+}
+
+// planDbVolumeMove decides whether the StatefulSets must be recreated and whether the runai-db PVC must be deleted,
+// which is when the node the volume was provisioned on is not a system node
+func planDbVolumeMove(flags nodeRoleTypes, client *client.Client, nodesInCluster map[string]v1.Node, nodeWithRestrictRunaiSystemExist bool, namespace string) (deleteStatefulSets, deletePvc bool) {
+	if !flags.RunaiSystemWorker || !nodeWithRestrictRunaiSystemExist {
+		return false, false
+	}
+
+	pvc, _ := client.GetClientset().CoreV1().PersistentVolumeClaims(namespace).Get(runaiDbPvcName, metav1.GetOptions{})
+	pvcNode, found := pvc.Annotations[selectedNodeAnnotation]
 	if found {
 		nodeInfo, found := nodesInCluster[pvcNode]
 		if !found {
 			fmt.Printf("Failed to find PVC node in cluster, node: %v\n", pvcNode)
-			os.Exit(1)
+			journal.Exit()
 		}
 
 		if _, found := nodeInfo.Labels[systemWorkerLabel]; found { // no need to delete the pvc - already on a system node
-			return
+			return false, false
 		}
-
-		client.GetClientset().CoreV1().PersistentVolumeClaims(namespace).Delete("data-runai-db-0", &metav1.DeleteOptions{})
-		log.Debugf("Deleted PVC data-runai-db-0")
+		return true, true
 	}
+	return true, false
+}
 
-	stsList, err := client.GetClientset().AppsV1().StatefulSets(namespace).List(metav1.ListOptions{})
+func statefulSetPods(client *client.Client, sts appsv1.StatefulSet) []v1.Pod {
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
 	if err != nil {
-		log.Debugf("Failed to list statefulsets in the %s namespace", namespace)
-		return
+		log.Debugf("Failed to parse the selector of statefulset %s: %v", sts.Name, err)
+		return nil
 	}
-
-	for _, sts := range stsList.Items {
-		client.GetClientset().AppsV1().StatefulSets(namespace).Delete(sts.Name, &metav1.DeleteOptions{})
-		log.Debugf("Deleted Statefulset: %v", sts.Name)
+	pods, err := client.GetClientset().CoreV1().Pods(sts.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		log.Debugf("Failed to list the pods of statefulset %s: %v", sts.Name, err)
+		return nil
 	}
+	return pods.Items
 }
 
-func updateRunaiConfigurations(client *client.Client, flags nodeRoleTypes, nodesInCluster map[string]v1.Node, withBackend bool) {
+func updateRunaiConfigurations(client *client.Client, flags nodeRoleTypes, nodesInCluster map[string]v1.Node, withBackend bool, j *journal.Journal) {
 	log.Info("Updating Run:AI configurations")
-	nodeWithRestrictSchedulingExist := false
-	nodeWithRestrictRunaiSystemExist := false
+	nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist := nodeRolesExist(nodesInCluster)
+	log.Debugf("Nodes with cpu or gpu workers already exist: %v", nodeWithRestrictSchedulingExist)
+	log.Debugf("Nodes with runai system workers already exist: %v", nodeWithRestrictRunaiSystemExist)
+	taintedRoles := roleTaintsExist(nodesInCluster)
+	j.Step("scale-down-operator", func() {
+		j.ScaleDown(client, common.RunaiNamespace, common.RunaiOperatorDeploymentName)
+	})
+	j.Step("update-operator-affinity", func() {
+		updateDeploymentWithAffinity(client, flags, common.RunaiNamespace, common.RunaiOperatorDeploymentName, nodeWithRestrictRunaiSystemExist, taintedRoles, j)
+	})
+	j.Step("update-runaiconfig", func() {
+		updateRunaiConfigIfNeeded(client, flags, nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist, taintedRoles, j)
+	})
+	j.Step("move-resources", func() {
+		deleteResourcesIfNeeded(flags, client, nodesInCluster, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist, true, common.RunaiNamespace)
+	})
+	j.Step("restore-operator", func() {
+		j.RestoreReplicas(client, common.RunaiNamespace, common.RunaiOperatorDeploymentName)
+	})
+
+	if withBackend {
+		backend := detectBackendOrExit(client)
+		operatorNamespace, operatorName, hasOperator := backend.operator()
+		if hasOperator {
+			j.Step("scale-down-backend-operator", func() {
+				j.ScaleDown(client, operatorNamespace, operatorName)
+			})
+			j.Step("update-backend-operator-affinity", func() {
+				updateDeploymentWithAffinity(client, flags, operatorNamespace, operatorName, nodeWithRestrictRunaiSystemExist, taintedRoles, j)
+			})
+		}
+		j.Step("update-backend-values", func() {
+			updateBackendIfNeeded(client, flags, backend, nodeWithRestrictRunaiSystemExist, j)
+		})
+		// the pods of a Helm 3 release keep their affinity until the release is upgraded
+		if _, isHelm3 := backend.(*helm3Backend); !isHelm3 {
+			j.Step("move-backend-resources", func() {
+				deleteResourcesIfNeeded(flags, client, nodesInCluster, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist, false, common.RunaiBackendNamespace)
+			})
+		}
+		if hasOperator {
+			j.Step("restore-backend-operator", func() {
+				j.RestoreReplicas(client, operatorNamespace, operatorName)
+			})
+		}
+	}
+}
+
+// beginJournal starts the journal of a node-role command, there is none for dry-runs
+func beginJournal(client *client.Client, flags nodeRoleTypes, command string) *journal.Journal {
+	if flags.DryRun {
+		return nil
+	}
+	j, err := journal.Begin(client, command)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	return j
+}
+
+// nodeRolesExist checks whether any node has a worker role, which restricts scheduling, and whether any node has the
+// system role, which restricts the Run:AI system pods
+func nodeRolesExist(nodesInCluster map[string]v1.Node) (nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist bool) {
 	for _, nodeInfo := range nodesInCluster {
 		_, foundCpu := nodeInfo.Labels[cpuWorkerLabel]
 		_, foundGpu := nodeInfo.Labels[gpuWorkerLabel]
 		_, foundSystem := nodeInfo.Labels[systemWorkerLabel]
 		if foundCpu || foundGpu {
-			nodeWithRestrictSchedulingExist = foundCpu || foundGpu
+			nodeWithRestrictSchedulingExist = true
 		}
 		if foundSystem {
-			nodeWithRestrictRunaiSystemExist = foundSystem
+			nodeWithRestrictRunaiSystemExist = true
 		}
 	}
-	log.Debugf("Nodes with cpu or gpu workers already exist: %v", nodeWithRestrictSchedulingExist)
-	log.Debugf("Nodes with runai system workers already exist: %v", nodeWithRestrictRunaiSystemExist)
-	common.ScaleRunaiOperator(client, 0)
-	updateDeploymentWithAffinity(client, flags, common.RunaiNamespace, common.RunaiOperatorDeploymentName, nodeWithRestrictRunaiSystemExist)
-	updateRunaiConfigIfNeeded(client, flags, nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist)
-	deleteResourcesIfNeeded(flags, client, nodesInCluster, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist, true, common.RunaiNamespace)
-	common.ScaleRunaiOperator(client, 1)
-
-	if withBackend {
-		common.ScaleRunaiBackendOperator(client, 0)
-		updateDeploymentWithAffinity(client, flags, common.RunaiBackendNamespace, common.RunaiBackendOperatorDeploymentName, nodeWithRestrictRunaiSystemExist)
-		updateHelmReleaseIfNeeded(client, flags, nodeWithRestrictRunaiSystemExist)
-		deleteResourcesIfNeeded(flags, client, nodesInCluster, nodeWithRestrictRunaiSystemExist, nodeWithRestrictSchedulingExist, false, common.RunaiBackendNamespace)
-		common.ScaleRunaiBackendOperator(client, 1)
-	}
+	return nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist
 }
 
-func updateDeploymentWithAffinity(client *client.Client, flags nodeRoleTypes, namespace, deploymentName string, nodeWithRestrictRunaiSystemExist bool) {
+// updateDeploymentWithAffinity makes the deployment require a system node and tolerate the system taint, when there are
+// such nodes
+func updateDeploymentWithAffinity(client *client.Client, flags nodeRoleTypes, namespace, deploymentName string, nodeWithRestrictRunaiSystemExist bool, taintedRoles map[string]bool, j *journal.Journal) {
 	if !flags.RunaiSystemWorker {
 		return
 	}
+	if err := setDeploymentAffinity(client, namespace, deploymentName, nodeWithRestrictRunaiSystemExist, taintedRoles, j); err != nil {
+		log.Infof("Failed to update the %s, error: %v", deploymentName, err)
+		journal.Exit()
+	}
+	log.Debugf("Updated %s to have node affinity and tolerations and scaled to 0 replicas", deploymentName)
+}
 
+// setDeploymentAffinity requires the system role for the pods of a deployment when nodeWithRestrictRunaiSystemExist is
+// set and makes them tolerate the taint of the system role when it is tainted. An unchanged deployment is not updated.
+func setDeploymentAffinity(client *client.Client, namespace, deploymentName string, nodeWithRestrictRunaiSystemExist bool, taintedRoles map[string]bool, j *journal.Journal) error {
 	var err error
 	var deployment *appsv1.Deployment
-
 	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
 		deployment, err = client.GetClientset().AppsV1().Deployments(namespace).Get(deploymentName, metav1.GetOptions{})
 		if err != nil {
-			log.Infof("Failed to get runai-operator, error: %v", err)
-			os.Exit(1)
+			return err
 		}
+		podSpec := deployment.Spec.Template.Spec.DeepCopy()
 		if nodeWithRestrictRunaiSystemExist {
-			deployment.Spec.Template.Spec.Affinity = &v1.Affinity{
+			podSpec.Affinity = &v1.Affinity{
 				NodeAffinity: &v1.NodeAffinity{
 					RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
 						NodeSelectorTerms: []v1.NodeSelectorTerm{
@@ -226,24 +388,24 @@ func updateDeploymentWithAffinity(client *client.Client, flags nodeRoleTypes, na
 				},
 			}
 		} else {
-			deployment.Spec.Template.Spec.Affinity = nil
+			podSpec.Affinity = nil
+		}
+		podSpec.Tolerations = desiredTolerations(podSpec.Tolerations, []string{systemWorkerLabel}, taintedRoles)
+		if reflect.DeepEqual(podSpec.Affinity, deployment.Spec.Template.Spec.Affinity) && reflect.DeepEqual(podSpec.Tolerations, deployment.Spec.Template.Spec.Tolerations) {
+			return nil
 		}
+		j.RecordDeploymentTemplate(deployment)
+		deployment.Spec.Template.Spec = *podSpec
 		_, err = client.GetClientset().AppsV1().Deployments(namespace).Update(deployment)
-		if err != nil {
-			log.Debugf("Failed to update the %s, attempt: %v error: %v", deploymentName, i, err)
-			continue
+		if err == nil {
+			return nil
 		}
-		break
+		log.Debugf("Failed to update the %s, attempt: %v error: %v", deploymentName, i, err)
 	}
-	if err != nil {
-		log.Infof("Failed to update the %s, error: %v", deploymentName, err)
-		os.Exit(1)
-	}
-
-	log.Debugf("Updated %s to have node affinity and scaled to 0 replicas", deploymentName)
+	return err
 }
 
-func updateRunaiConfigIfNeeded(client *client.Client, flags nodeRoleTypes, nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist bool) {
+func updateRunaiConfigIfNeeded(client *client.Client, flags nodeRoleTypes, nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist bool, taintedRoles map[string]bool, j *journal.Journal) {
 	runaiconfigResource := schema.GroupVersionResource{Group: "run.ai", Version: "v1", Resource: "runaiconfigs"}
 	var error error
 	var runaiConfig *unstructured.Unstructured
@@ -251,31 +413,28 @@ func updateRunaiConfigIfNeeded(client *client.Client, flags nodeRoleTypes, nodeW
 		runaiConfig, error = client.GetDynamicClient().Resource(runaiconfigResource).Namespace(common.RunaiNamespace).Get("runai", metav1.GetOptions{})
 		if error != nil {
 			fmt.Println("Failed to get RunaiConfig, Run:AI is not installed on the cluster")
-			os.Exit(1)
+			journal.Exit()
 		}
+		j.RecordObjectSpec(runaiconfigResource, runaiConfig)
 		nodeAffinityMapOldValues, _, err := unstructured.NestedMap(runaiConfig.Object, "spec", "global", "nodeAffinity")
 		log.Debugf("RunaiConfig old values of nodeAffinityMap: %v", nodeAffinityMapOldValues)
 
-		nodeAffinityMap := map[string]interface{}{}
-		for key, val := range nodeAffinityMapOldValues {
-			nodeAffinityMap[key] = val
-		}
 		if err != nil {
 			fmt.Printf("Failed to get nodeAffinityMap from runaiConfig, error: %v", err)
-			os.Exit(1)
-		}
-
-		if flags.CpuWorker || flags.GpuWorker {
-			nodeAffinityMap["restrictScheduling"] = nodeWithRestrictSchedulingExist
+			journal.Exit()
 		}
+		nodeAffinityMap := desiredNodeAffinity(flags, nodeAffinityMapOldValues, nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist)
+		tolerationsOldValues, _, _ := unstructured.NestedSlice(runaiConfig.Object, "spec", "global", "tolerations")
+		tolerations := desiredConfigTolerations(tolerationsOldValues, roleLabels(flags), taintedRoles)
 
-		if flags.RunaiSystemWorker {
-			nodeAffinityMap["restrictRunaiSystem"] = nodeWithRestrictRunaiSystemExist
-		}
-
-		if !reflect.DeepEqual(nodeAffinityMap, nodeAffinityMapOldValues) {
-			log.Debugf("Updating RunaiConfig with nodeAffinityMap: %v", nodeAffinityMap)
+		if !reflect.DeepEqual(nodeAffinityMap, nodeAffinityMapOldValues) || !tolerationsEqual(tolerations, tolerationsOldValues) {
+			log.Debugf("Updating RunaiConfig with nodeAffinityMap: %v, tolerations: %v", nodeAffinityMap, tolerations)
 			err = unstructured.SetNestedMap(runaiConfig.Object, nodeAffinityMap, "spec", "global", "nodeAffinity")
+			if len(tolerations) > 0 {
+				err = unstructured.SetNestedSlice(runaiConfig.Object, tolerations, "spec", "global", "tolerations")
+			} else {
+				unstructured.RemoveNestedField(runaiConfig.Object, "spec", "global", "tolerations")
+			}
 			_, error = client.GetDynamicClient().Resource(runaiconfigResource).Namespace(common.RunaiNamespace).Update(runaiConfig, metav1.UpdateOptions{})
 			if error != nil {
 				log.Debugf("Failed to update runaiconfig, attempt: %v, error: %v", i, error)
@@ -287,162 +446,189 @@ func updateRunaiConfigIfNeeded(client *client.Client, flags nodeRoleTypes, nodeW
 
 	if error != nil {
 		log.Infof("Failed to update runaiconfig, error: %v", error)
-		os.Exit(1)
+		journal.Exit()
 	}
 }
 
-func updateHelmReleaseIfNeeded(client *client.Client, flags nodeRoleTypes, nodeWithRestrictRunaiSystemExist bool) {
-	helmReleaseResource := schema.GroupVersionResource{Group: "helm.fluxcd.io", Version: "v1", Resource: "HelmRelease"}
-	var error error
-	var runaiBackendHelmRelease *unstructured.Unstructured
-	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
-		runaiBackendHelmRelease, error = client.GetDynamicClient().Resource(helmReleaseResource).Namespace(common.RunaiBackendNamespace).Get("runai-backend", metav1.GetOptions{})
-		if error != nil {
-			fmt.Println("Failed to get HelmRelease, Run:AI Backend is not installed on the cluster")
-			os.Exit(1)
-		}
-		nodeAffinityMapOldValues, _, err := unstructured.NestedMap(runaiBackendHelmRelease.Object, "spec", "global", "nodeAffinity")
-		log.Debugf("HelmRelease old values of nodeAffinityMap: %v", nodeAffinityMapOldValues)
-
-		nodeAffinityMap := map[string]interface{}{}
-		for key, val := range nodeAffinityMapOldValues {
-			nodeAffinityMap[key] = val
-		}
-		if err != nil {
-			fmt.Printf("Failed to get nodeAffinityMap from runaiBackendHelmRelease, error: %v", err)
-			os.Exit(1)
-		}
-
-		if flags.RunaiSystemWorker {
-			nodeAffinityMap["restrictRunaiSystem"] = nodeWithRestrictRunaiSystemExist
-		}
-
-		if !reflect.DeepEqual(nodeAffinityMap, nodeAffinityMapOldValues) {
-			log.Debugf("Updating HelmRelease with nodeAffinityMap: %v", nodeAffinityMap)
-			err = unstructured.SetNestedMap(runaiBackendHelmRelease.Object, nodeAffinityMap, "spec", "global", "nodeAffinity")
-			_, error = client.GetDynamicClient().Resource(helmReleaseResource).Namespace(common.RunaiNamespace).Update(runaiBackendHelmRelease, metav1.UpdateOptions{})
-			if error != nil {
-				log.Debugf("Failed to update HelmRelease, attempt: %v, error: %v", i, error)
-				continue
-			}
-		}
-		break
+// desiredNodeAffinity returns the RunaiConfig nodeAffinity values with the restrictions of the changed roles
+func desiredNodeAffinity(flags nodeRoleTypes, nodeAffinityMapOldValues map[string]interface{}, nodeWithRestrictSchedulingExist, nodeWithRestrictRunaiSystemExist bool) map[string]interface{} {
+	nodeAffinityMap := map[string]interface{}{}
+	for key, val := range nodeAffinityMapOldValues {
+		nodeAffinityMap[key] = val
 	}
-
-	if error != nil {
-		log.Infof("Failed to update HelmRelease, error: %v", error)
-		os.Exit(1)
+	if flags.CpuWorker || flags.GpuWorker {
+		nodeAffinityMap["restrictScheduling"] = nodeWithRestrictSchedulingExist
+	}
+	if flags.RunaiSystemWorker {
+		nodeAffinityMap["restrictRunaiSystem"] = nodeWithRestrictRunaiSystemExist
 	}
+	return nodeAffinityMap
 }
 
-func labelNodesWithRolesAndGetNodesInCluster(client *client.Client, flags nodeRoleTypes, args []string, shouldEnableLabel bool) map[string]v1.Node {
+// labelNodesWithRolesAndGetNodesInCluster sets or removes the roles of the selected nodes and returns the nodes in the
+// cluster, with the updated ones, and the number of nodes that failed to update
+func labelNodesWithRolesAndGetNodesInCluster(client *client.Client, flags nodeRoleTypes, args []string, shouldEnableLabel bool, j *journal.Journal) (map[string]v1.Node, int) {
 	log.Info("Updating nodes with roles")
 
+	targets, err := newNodeTargets(flags, args)
+	if err != nil {
+		fmt.Println(err)
+		j.Finish()
+		os.Exit(1)
+	}
+
 	allNodeClusters := map[string]v1.Node{}
 	nodesInCluster, err := client.GetClientset().CoreV1().Nodes().List(metav1.ListOptions{})
 	if err != nil || len(nodesInCluster.Items) == 0 {
 		fmt.Println("Failed to list nodes in cluster")
+		j.Finish()
 		os.Exit(1)
 	}
 
-	wasAnyNodeUpdated := false
-	if flags.AllNodes {
-		for _, nodeInfo := range nodesInCluster.Items {
-			updateLabelsSingleNode(&nodeInfo, flags, client, shouldEnableLabel)
-			allNodeClusters[nodeInfo.Name] = nodeInfo
-			wasAnyNodeUpdated = true
+	before := map[string]v1.Node{}
+	var selected []string
+	for _, nodeInfo := range nodesInCluster.Items {
+		before[nodeInfo.Name] = nodeInfo
+		if targets.matches(&nodeInfo) {
+			selected = append(selected, nodeInfo.Name)
+		}
+	}
+	if !journal.IsResuming() {
+		// a resumed run already changed the labels the checks compare with
+		labelsToSet, labelsToRemove := roleLabels(flags), []string(nil)
+		if !shouldEnableLabel {
+			labelsToSet, labelsToRemove = nil, roleLabels(flags)
 		}
-		log.Debugf("Successfully updated all nodes with roles")
-		return allNodeClusters
+		guardNodeRoleChange(client, flags, before, plannedNodeLabels(before, selected, labelsToSet, labelsToRemove, flags.Taint && shouldEnableLabel), j)
 	}
 
-	nodesToUpdateMap := map[string]bool{}
-	wasNodeUpdated := map[string]bool{}
-	for _, nodeToLabel := range args {
-		nodesToUpdateMap[nodeToLabel] = true
-		wasNodeUpdated[nodeToLabel] = false
+	isSelected := map[string]bool{}
+	for _, name := range selected {
+		isSelected[name] = true
 	}
+	wasAnyNodeUpdated := false
+	var updates []nodeLabelUpdate
 	for _, nodeInfo := range nodesInCluster.Items {
-		if nodesToUpdateMap[nodeInfo.Name] {
-			updateLabelsSingleNode(&nodeInfo, flags, client, shouldEnableLabel)
+		if isSelected[nodeInfo.Name] {
+			if flags.DryRun {
+				simulateLabelsSingleNode(&nodeInfo, flags, shouldEnableLabel)
+			} else {
+				j.RecordNodeLabels(&nodeInfo, roleLabels(flags))
+				j.RecordNodeTaints(&nodeInfo)
+				updates = append(updates, labelsSingleNodeUpdate(nodeInfo, flags, shouldEnableLabel))
+			}
 			wasAnyNodeUpdated = true
-			wasNodeUpdated[nodeInfo.Name] = true
-			allNodeClusters[nodeInfo.Name] = nodeInfo
 		}
 		allNodeClusters[nodeInfo.Name] = nodeInfo
 	}
 
-	for nodeName := range wasNodeUpdated {
-		if !wasNodeUpdated[nodeName] {
-			log.Infof("Node: %v was not found in cluster", nodeName)
-		}
+	for _, pattern := range targets.unmatchedPatterns() {
+		log.Infof("Node: %v was not found in cluster", pattern)
 	}
 
 	if !wasAnyNodeUpdated {
-		log.Infof("All nodes are already updated")
+		log.Infof("No nodes were updated")
+		j.Finish()
 		os.Exit(1)
 	}
 
-	return allNodeClusters
+	failed := updateNodesAndPrintSummary(client, updates, flags.Parallelism, allNodeClusters)
+	return allNodeClusters, failed
 }
 
-func updateLabelsSingleNode(nodeInfo *v1.Node, flags nodeRoleTypes, client *client.Client, shouldEnableLabel bool) {
-	var err error
-	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
-		if nodeInfo.Labels == nil {
-			nodeInfo.Labels = map[string]string{}
-		}
-		if flags.GpuWorker {
-			if shouldEnableLabel {
-				nodeInfo.Labels[gpuWorkerLabel] = ""
-			} else {
-				delete(nodeInfo.Labels, gpuWorkerLabel)
-			}
-		}
-		if flags.CpuWorker {
-			if shouldEnableLabel {
-				nodeInfo.Labels[cpuWorkerLabel] = ""
-			} else {
-				delete(nodeInfo.Labels, cpuWorkerLabel)
-			}
-		}
-		if flags.RunaiSystemWorker {
-			if shouldEnableLabel {
-				nodeInfo.Labels[systemWorkerLabel] = ""
-			} else {
-				delete(nodeInfo.Labels, systemWorkerLabel)
-			}
+func labelsSingleNodeUpdate(nodeInfo v1.Node, flags nodeRoleTypes, shouldEnableLabel bool) nodeLabelUpdate {
+	if shouldEnableLabel {
+		return roleLabelUpdate(nodeInfo, roleLabels(flags), nil, flags.Taint)
+	}
+	return roleLabelUpdate(nodeInfo, nil, roleLabels(flags), false)
+}
+
+// simulateLabelsSingleNode changes the labels of a copy of the node, as labelsSingleNodeUpdate would, without updating it
+func simulateLabelsSingleNode(nodeInfo *v1.Node, flags nodeRoleTypes, shouldEnableLabel bool) {
+	if shouldEnableLabel {
+		simulateNodeLabels(nodeInfo, roleLabels(flags), nil, flags.Taint)
+	} else {
+		simulateNodeLabels(nodeInfo, nil, roleLabels(flags), false)
+	}
+}
+
+func roleLabels(flags nodeRoleTypes) []string {
+	var labels []string
+	if flags.GpuWorker {
+		labels = append(labels, gpuWorkerLabel)
+	}
+	if flags.CpuWorker {
+		labels = append(labels, cpuWorkerLabel)
+	}
+	if flags.RunaiSystemWorker {
+		labels = append(labels, systemWorkerLabel)
+	}
+	return labels
+}
+
+func setNodeLabels(nodeInfo *v1.Node, labelsToSet, labelsToRemove []string) {
+	if nodeInfo.Labels == nil {
+		nodeInfo.Labels = map[string]string{}
+	}
+	for _, label := range labelsToSet {
+		nodeInfo.Labels[label] = ""
+	}
+	for _, label := range labelsToRemove {
+		delete(nodeInfo.Labels, label)
+	}
+}
+
+// simulateNodeLabels changes the labels and taints of the node in place, after copying them so that the listed node is
+// not changed, and prints the labels and taints that would change
+func simulateNodeLabels(nodeInfo *v1.Node, labelsToSet, labelsToRemove []string, taint bool) {
+	labels := map[string]string{}
+	for key, value := range nodeInfo.Labels {
+		labels[key] = value
+	}
+	nodeInfo.Labels = labels
+	for _, label := range labelsToSet {
+		if _, found := labels[label]; !found {
+			fmt.Printf("node/%s: + %s\n", nodeInfo.Name, label)
 		}
-		_, err = client.GetClientset().CoreV1().Nodes().Update(nodeInfo)
-		if err == nil {
-			break
+	}
+	for _, label := range labelsToRemove {
+		if _, found := labels[label]; found {
+			fmt.Printf("node/%s: - %s\n", nodeInfo.Name, label)
 		}
-		nodeInfo, _ = client.GetClientset().CoreV1().Nodes().Get(nodeInfo.Name, metav1.GetOptions{})
-
-		log.Debugf("Failed to update node, attempt: %v, error: %v", i, err)
 	}
-	if err != nil {
-		log.Infof("Failed to update node: %v, ", err)
-		os.Exit(1)
+	setNodeLabels(nodeInfo, labelsToSet, labelsToRemove)
+
+	var labelsToTaint []string
+	if taint {
+		labelsToTaint = labelsToSet
 	}
+	simulateNodeTaints(nodeInfo, labelsToTaint, labelsToRemove)
 }
 
 func Remove() *cobra.Command {
 	flags := nodeRoleTypes{}
 	withBackend := false
 	var command = &cobra.Command{
-		Use:     "node-role NODE_NAME",
-		Aliases: []string{"node-roles"},
-		Short:   "Remove node with roles",
+		Use:         "node-role [NODE_NAME...]",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Aliases:     []string{"node-roles"},
+		Short:       "Remove node with roles",
 		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) == 0 && !flags.AllNodes {
+			if !hasNodeTargets(flags, args) {
 				fmt.Println("No nodes were selected")
 				cmd.HelpFunc()(cmd, args)
 				os.Exit(1)
 			}
 			client := client.GetClient()
-			nodesInCluster := labelNodesWithRolesAndGetNodesInCluster(client, flags, args, false)
-			updateRunaiConfigurations(client, flags, nodesInCluster, withBackend)
+			j := beginJournal(client, flags, "remove node-role")
+			nodesInCluster, failed := labelNodesWithRolesAndGetNodesInCluster(client, flags, args, false, j)
+			if flags.DryRun {
+				printNodeRolePlan(client, flags, nodesInCluster, withBackend)
+				return
+			}
+			updateRunaiConfigurations(client, flags, nodesInCluster, withBackend, j)
+			exitOnFailedNodes(failed, j)
+			j.Finish()
 			log.Infof("Successfully updated nodes with roles")
 		},
 	}
@@ -452,5 +638,10 @@ func Remove() *cobra.Command {
 	command.Flags().BoolVar(&flags.CpuWorker, "cpu-worker", false, "Set nodes with node-role of CPU Worker.")
 	command.Flags().BoolVar(&flags.GpuWorker, "gpu-worker", false, "Set nodes with node-role of GPU Worker.")
 	command.Flags().BoolVar(&flags.RunaiSystemWorker, "runai-system-worker", false, "Set nodes with node-role of Run:AI System Worker.")
+	addNodeTargetFlags(command, &flags)
+	addEvictionFlags(command, &flags)
+	addSafetyFlags(command, &flags)
+	addParallelismFlag(command, &flags)
+	command.Flags().BoolVar(&flags.DryRun, "dry-run", false, "Print the label changes and the Run:AI pods, StatefulSets and PVCs that would be moved without changing anything")
 	return command
 }
@@ -0,0 +1,189 @@
+package noderole
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const defaultParallelism = 10
+
+// nodeLabelUpdate is the change of the labels, and of the role taints, of a node
+type nodeLabelUpdate struct {
+	node           v1.Node
+	labelsToSet    map[string]string
+	labelsToRemove []string
+	rolesToTaint   []string
+	rolesToUntaint []string
+}
+
+// nodeUpdateResult is the node after its update, or the node as listed and the error when the update failed
+type nodeUpdateResult struct {
+	node    v1.Node
+	changed bool
+	err     error
+}
+
+func addParallelismFlag(command *cobra.Command, flags *nodeRoleTypes) {
+	command.Flags().IntVar(&flags.Parallelism, "parallelism", defaultParallelism, "Number of nodes to update in parallel")
+}
+
+// roleLabelUpdate adds the labelsToSet, with an empty value, and removes the labelsToRemove of a node, together with
+// the taints of the removed roles. The taints of the set roles are added when taint is set.
+func roleLabelUpdate(nodeInfo v1.Node, labelsToSet, labelsToRemove []string, taint bool) nodeLabelUpdate {
+	update := nodeLabelUpdate{node: nodeInfo, labelsToSet: map[string]string{}, labelsToRemove: labelsToRemove, rolesToUntaint: labelsToRemove}
+	for _, label := range labelsToSet {
+		update.labelsToSet[label] = ""
+	}
+	if taint {
+		update.rolesToTaint = labelsToSet
+	}
+	return update
+}
+
+func (u nodeLabelUpdate) apply(nodeInfo *v1.Node) {
+	if nodeInfo.Labels == nil {
+		nodeInfo.Labels = map[string]string{}
+	}
+	for label, value := range u.labelsToSet {
+		nodeInfo.Labels[label] = value
+	}
+	for _, label := range u.labelsToRemove {
+		delete(nodeInfo.Labels, label)
+	}
+	setNodeTaints(nodeInfo, u.rolesToTaint, u.rolesToUntaint)
+}
+
+// nodePatch returns the strategic merge patch of the update, which only has the labels that change, so that it does
+// not conflict with the status updates of the kubelet. The taints are replaced as a whole, so a patch that changes them
+// has the resourceVersion of the node and fails when another controller changed the node since.
+func nodePatch(current *v1.Node, update nodeLabelUpdate) ([]byte, bool, error) {
+	updated := current.DeepCopy()
+	update.apply(updated)
+
+	labels := map[string]interface{}{}
+	for key, value := range updated.Labels {
+		if old, found := current.Labels[key]; !found || old != value {
+			labels[key] = value
+		}
+	}
+	for key := range current.Labels {
+		if _, found := updated.Labels[key]; !found {
+			labels[key] = nil
+		}
+	}
+	metadata := map[string]interface{}{}
+	patch := map[string]interface{}{"metadata": metadata}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if !reflect.DeepEqual(current.Spec.Taints, updated.Spec.Taints) {
+		metadata["resourceVersion"] = current.ResourceVersion
+		patch["spec"] = map[string]interface{}{"taints": updated.Spec.Taints}
+	}
+	if len(metadata) == 0 {
+		return nil, false, nil
+	}
+	data, err := json.Marshal(patch)
+	return data, true, err
+}
+
+// patchNode patches a node with the update, getting the node again when the patch fails
+func patchNode(client *client.Client, update nodeLabelUpdate) nodeUpdateResult {
+	current := update.node.DeepCopy()
+	var err error
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		var data []byte
+		var changed bool
+		data, changed, err = nodePatch(current, update)
+		if err != nil || !changed {
+			break
+		}
+		var patched *v1.Node
+		patched, err = client.GetClientset().CoreV1().Nodes().Patch(current.Name, types.StrategicMergePatchType, data)
+		if err == nil {
+			return nodeUpdateResult{node: *patched, changed: true}
+		}
+		log.Debugf("Failed to patch node %s, attempt: %v, error: %v", current.Name, i, err)
+		if latest, getErr := client.GetClientset().CoreV1().Nodes().Get(current.Name, metav1.GetOptions{}); getErr == nil {
+			current = latest
+		}
+	}
+	if err != nil {
+		return nodeUpdateResult{node: update.node, err: err}
+	}
+	return nodeUpdateResult{node: *current}
+}
+
+// updateNodes patches the nodes by a pool of parallelism workers. A node that fails does not stop the others, its
+// result has the error.
+func updateNodes(client *client.Client, updates []nodeLabelUpdate, parallelism int) []nodeUpdateResult {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	results := make([]nodeUpdateResult, len(updates))
+	workqueue.ParallelizeUntil(context.TODO(), parallelism, len(updates), func(i int) {
+		results[i] = patchNode(client, updates[i])
+	})
+	return results
+}
+
+// updateNodesAndPrintSummary updates the nodes, stores the updated ones in nodesInCluster and prints a summary of the
+// results. It returns the number of nodes that failed.
+func updateNodesAndPrintSummary(client *client.Client, updates []nodeLabelUpdate, parallelism int, nodesInCluster map[string]v1.Node) int {
+	if len(updates) == 0 {
+		return 0
+	}
+	results := updateNodes(client, updates, parallelism)
+	updated, unchanged := 0, 0
+	failed := map[string]error{}
+	for _, result := range results {
+		switch {
+		case result.err != nil:
+			failed[result.node.Name] = result.err
+		case result.changed:
+			updated++
+		default:
+			unchanged++
+		}
+		if result.err == nil {
+			nodesInCluster[result.node.Name] = result.node
+		}
+	}
+
+	log.Infof("Updated %d nodes, %d unchanged, %d failed", updated, unchanged, len(failed))
+	var names []string
+	for name := range failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  - node/%s: %v\n", name, failed[name])
+	}
+	return len(failed)
+}
+
+// exitOnFailedNodes exits when nodes failed to update. It is called after the Run:AI configurations were updated
+// for the other nodes, so the journal is finished: resuming it would skip those completed steps, while running the
+// command again labels the failed nodes and updates the configurations for them.
+func exitOnFailedNodes(failed int, j *journal.Journal) {
+	if failed == 0 {
+		return
+	}
+	j.Finish()
+	log.Errorf("Failed to update %d nodes, run the command again to retry them", failed)
+	os.Exit(1)
+}
@@ -0,0 +1,76 @@
+package noderole
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodePatch(t *testing.T) {
+	otherTaint := v1.Taint{Key: "node.kubernetes.io/unreachable", Effect: v1.TaintEffectNoExecute}
+	node := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", ResourceVersion: "7", Labels: map[string]string{cpuWorkerLabel: "", "zone": "a"}},
+		Spec:       v1.NodeSpec{Taints: []v1.Taint{roleTaint(cpuWorkerLabel), otherTaint}},
+	}
+
+	tests := []struct {
+		name     string
+		update   nodeLabelUpdate
+		expected string
+	}{
+		{
+			name:   "label already set",
+			update: roleLabelUpdate(node, []string{cpuWorkerLabel}, nil, false),
+		},
+		{
+			name:     "label added",
+			update:   roleLabelUpdate(node, []string{gpuWorkerLabel}, nil, false),
+			expected: `{"metadata":{"labels":{"node-role.kubernetes.io/runai-gpu-worker":""}}}`,
+		},
+		{
+			name:   "role moved with taints",
+			update: roleLabelUpdate(node, []string{gpuWorkerLabel}, []string{cpuWorkerLabel}, true),
+			expected: `{"metadata":{"labels":{"node-role.kubernetes.io/runai-cpu-worker":null,"node-role.kubernetes.io/runai-gpu-worker":""},"resourceVersion":"7"},` +
+				`"spec":{"taints":[{"key":"node.kubernetes.io/unreachable","effect":"NoExecute"},{"key":"runai/gpu-worker","value":"true","effect":"NoSchedule"}]}}`,
+		},
+		{
+			name:     "pool label set",
+			update:   nodePoolLabelUpdate(node, "pool-a"),
+			expected: `{"metadata":{"labels":{"runai/node-pool":"pool-a"}}}`,
+		},
+		{
+			name:   "missing pool label removed",
+			update: nodePoolLabelUpdate(node, ""),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, changed, err := nodePatch(&node, test.update)
+			if err != nil {
+				t.Fatalf("nodePatch() error = %v", err)
+			}
+			if changed != (test.expected != "") {
+				t.Fatalf("nodePatch() changed = %v, patch %s", changed, data)
+			}
+			if !changed {
+				return
+			}
+			var patch, expected interface{}
+			if err := json.Unmarshal(data, &patch); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(patch, expected) {
+				t.Errorf("nodePatch() = %s, expected %s", data, test.expected)
+			}
+		})
+	}
+	if _, found := node.Labels[gpuWorkerLabel]; found || len(node.Spec.Taints) != 2 {
+		t.Errorf("nodePatch() changed the node: %v", node)
+	}
+}
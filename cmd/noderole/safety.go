@@ -0,0 +1,190 @@
+package noderole
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultMinSystemNodes = 1
+
+func addSafetyFlags(command *cobra.Command, flags *nodeRoleTypes) {
+	command.Flags().BoolVar(&flags.Force, "force", false, "Apply the change even if it would leave the cluster without enough Ready system or worker nodes")
+	command.Flags().IntVar(&flags.MinSystemNodes, "min-system-nodes", defaultMinSystemNodes, "Minimal number of Ready system nodes while Run:AI system pods are restricted to system nodes")
+}
+
+// plannedNodeLabels returns copies of the nodes with the labels and taints of the selected nodes changed
+func plannedNodeLabels(nodes map[string]v1.Node, selected []string, labelsToSet, labelsToRemove []string, taint bool) map[string]v1.Node {
+	var labelsToTaint []string
+	if taint {
+		labelsToTaint = labelsToSet
+	}
+	planned := map[string]v1.Node{}
+	for name, nodeInfo := range nodes {
+		planned[name] = nodeInfo
+	}
+	for _, name := range selected {
+		original := planned[name]
+		nodeInfo := original.DeepCopy()
+		setNodeLabels(nodeInfo, labelsToSet, labelsToRemove)
+		setNodeTaints(nodeInfo, labelsToTaint, labelsToRemove)
+		planned[name] = *nodeInfo
+	}
+	return planned
+}
+
+// guardNodeRoleChange explains the violations of the safety invariants by the planned node roles, and exits unless
+// --force is set, dropping the journal of the run that did not change anything. Dry-runs only print them.
+func guardNodeRoleChange(client *client.Client, flags nodeRoleTypes, before, after map[string]v1.Node, j *journal.Journal) {
+	violations := nodeRoleViolations(client, flags, before, after)
+	if len(violations) == 0 {
+		return
+	}
+	fmt.Println("The change would leave the cluster in an unsafe state:")
+	for _, violation := range violations {
+		fmt.Printf("  - %s\n", violation)
+	}
+	switch {
+	case flags.DryRun:
+		fmt.Printf("--force is required to apply it\n\n")
+	case flags.Force:
+		log.Warn("Applying the change anyway because --force is set")
+	default:
+		fmt.Println("Use --force to apply it anyway")
+		j.Finish()
+		os.Exit(1)
+	}
+}
+
+// nodeRoleViolations checks that the changed roles keep enough Ready system and worker nodes, that new GPU workers
+// have GPUs, that nodes getting a role are Ready and that the runai-db volume stays on an eligible node
+func nodeRoleViolations(client *client.Client, flags nodeRoleTypes, before, after map[string]v1.Node) []string {
+	var violations []string
+	if flags.RunaiSystemWorker {
+		systemBefore, systemAfter := nodesWithLabel(before, systemWorkerLabel), nodesWithLabel(after, systemWorkerLabel)
+		if len(systemBefore) > 0 && len(systemAfter) == 0 {
+			violations = append(violations, "no node would have the runai-system role: restrictRunaiSystem would be turned off and the Run:AI system pods would be rescheduled on any node")
+		}
+		if ready := readyNodes(after, systemAfter); len(systemAfter) > 0 && len(ready) < flags.MinSystemNodes {
+			violations = append(violations, fmt.Sprintf("%d of the %d system nodes would be Ready and schedulable (%s), at least %d are required while the Run:AI system pods are restricted to them",
+				len(ready), len(systemAfter), strings.Join(systemAfter, ", "), flags.MinSystemNodes))
+		}
+		if len(systemAfter) > 0 {
+			violations = append(violations, dbVolumeViolations(client, flags, after)...)
+		}
+	}
+
+	if flags.GpuWorker || flags.CpuWorker {
+		workersBefore, workersAfter := workerNodes(before), workerNodes(after)
+		if len(workersBefore) > 0 && len(workersAfter) == 0 {
+			violations = append(violations, "no node would have a worker role: restrictScheduling would be turned off and workloads would be scheduled on any node")
+		}
+		if len(workersAfter) > 0 && len(readyNodes(after, workersAfter)) == 0 {
+			violations = append(violations, fmt.Sprintf("none of the worker nodes (%s) would be Ready and schedulable while scheduling is restricted to them", strings.Join(workersAfter, ", ")))
+		}
+	}
+
+	var names []string
+	for name := range after {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		nodeInfo, previous := after[name], before[name]
+		gained := false
+		for _, label := range roleLabels(flags) {
+			_, had := previous.Labels[label]
+			_, has := nodeInfo.Labels[label]
+			gained = gained || (has && !had)
+		}
+		if !gained {
+			continue
+		}
+		if !isNodeReady(&nodeInfo) || nodeInfo.Spec.Unschedulable {
+			violations = append(violations, fmt.Sprintf("node %s would get a role but is not Ready and schedulable", name))
+		}
+		_, hadGpu := previous.Labels[gpuWorkerLabel]
+		if _, hasGpu := nodeInfo.Labels[gpuWorkerLabel]; hasGpu && !hadGpu {
+			capacity := nodeInfo.Status.Capacity[gpuResourceName]
+			allocatable := nodeInfo.Status.Allocatable[gpuResourceName]
+			if capacity.Value() == 0 && allocatable.Value() == 0 {
+				violations = append(violations, fmt.Sprintf("node %s would be a GPU worker but has no %s capacity", name, gpuResourceName))
+			}
+		}
+	}
+	return violations
+}
+
+// dbVolumeViolations checks that the node of the runai-db volume remains an eligible, Ready system node,
+// otherwise the volume would be deleted, or runai-db could not start
+func dbVolumeViolations(client *client.Client, flags nodeRoleTypes, after map[string]v1.Node) []string {
+	pvc, err := client.GetClientset().CoreV1().PersistentVolumeClaims(common.RunaiNamespace).Get(runaiDbPvcName, metav1.GetOptions{})
+	if err != nil {
+		log.Debugf("Failed to get the %s PVC: %v", runaiDbPvcName, err)
+		return nil
+	}
+	pvcNode, found := pvc.Annotations[selectedNodeAnnotation]
+	if !found {
+		return nil
+	}
+	nodeInfo, found := after[pvcNode]
+	if !found {
+		return []string{fmt.Sprintf("the %s volume is bound to node %s, which is not in the cluster", runaiDbPvcName, pvcNode)}
+	}
+	if _, isSystem := nodeInfo.Labels[systemWorkerLabel]; !isSystem {
+		if flags.NoEvict {
+			return []string{fmt.Sprintf("the %s volume is bound to node %s, which would not be a system node: runai-db cannot be rescheduled while its pods are restricted to system nodes", runaiDbPvcName, pvcNode)}
+		}
+		return []string{fmt.Sprintf("the %s volume is bound to node %s, which would not be a system node: the PVC would be deleted and runai-db would start with an empty database", runaiDbPvcName, pvcNode)}
+	}
+	if !isNodeReady(&nodeInfo) {
+		return []string{fmt.Sprintf("the %s volume is bound to node %s, which is not Ready: runai-db cannot start until it is", runaiDbPvcName, pvcNode)}
+	}
+	return nil
+}
+
+func nodesWithLabel(nodes map[string]v1.Node, label string) []string {
+	var names []string
+	for name, nodeInfo := range nodes {
+		if _, found := nodeInfo.Labels[label]; found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func workerNodes(nodes map[string]v1.Node) []string {
+	names := map[string]bool{}
+	for _, label := range []string{gpuWorkerLabel, cpuWorkerLabel} {
+		for _, name := range nodesWithLabel(nodes, label) {
+			names[name] = true
+		}
+	}
+	var result []string
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func readyNodes(nodes map[string]v1.Node, names []string) []string {
+	var ready []string
+	for _, name := range names {
+		nodeInfo := nodes[name]
+		if isNodeReady(&nodeInfo) && !nodeInfo.Spec.Unschedulable {
+			ready = append(ready, name)
+		}
+	}
+	return ready
+}
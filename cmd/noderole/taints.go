@@ -0,0 +1,142 @@
+package noderole
+
+import (
+	"fmt"
+	"reflect"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const roleTaintValue = "true"
+
+// roleTaintKeys are the keys of the NoSchedule taints that keep other workloads off the nodes of each role
+var roleTaintKeys = map[string]string{
+	gpuWorkerLabel:    "runai/gpu-worker",
+	cpuWorkerLabel:    "runai/cpu-worker",
+	systemWorkerLabel: "runai/system",
+}
+
+func roleTaint(label string) v1.Taint {
+	return v1.Taint{Key: roleTaintKeys[label], Value: roleTaintValue, Effect: v1.TaintEffectNoSchedule}
+}
+
+func roleToleration(label string) v1.Toleration {
+	return v1.Toleration{Key: roleTaintKeys[label], Operator: v1.TolerationOpEqual, Value: roleTaintValue, Effect: v1.TaintEffectNoSchedule}
+}
+
+// setNodeTaints adds the taints of the roles in labelsToTaint and removes the taints of the roles in labelsToRemove.
+// It returns the taints that were added and removed.
+func setNodeTaints(nodeInfo *v1.Node, labelsToTaint, labelsToRemove []string) (added, removed []v1.Taint) {
+	for _, label := range labelsToRemove {
+		taint := roleTaint(label)
+		var taints []v1.Taint
+		for _, existing := range nodeInfo.Spec.Taints {
+			if existing.MatchTaint(&taint) {
+				removed = append(removed, existing)
+				continue
+			}
+			taints = append(taints, existing)
+		}
+		nodeInfo.Spec.Taints = taints
+	}
+	for _, label := range labelsToTaint {
+		taint := roleTaint(label)
+		if !hasRoleTaint(nodeInfo, label) {
+			nodeInfo.Spec.Taints = append(nodeInfo.Spec.Taints, taint)
+			added = append(added, taint)
+		}
+	}
+	return added, removed
+}
+
+func hasRoleTaint(nodeInfo *v1.Node, label string) bool {
+	taint := roleTaint(label)
+	for _, existing := range nodeInfo.Spec.Taints {
+		if existing.MatchTaint(&taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// simulateNodeTaints changes the taints of the node in place, after copying them so that the listed node is not
+// changed, and prints the taints that would change
+func simulateNodeTaints(nodeInfo *v1.Node, labelsToTaint, labelsToRemove []string) {
+	nodeInfo.Spec.Taints = append([]v1.Taint(nil), nodeInfo.Spec.Taints...)
+	added, removed := setNodeTaints(nodeInfo, labelsToTaint, labelsToRemove)
+	for _, taint := range added {
+		fmt.Printf("node/%s: + taint %s\n", nodeInfo.Name, taint.ToString())
+	}
+	for _, taint := range removed {
+		fmt.Printf("node/%s: - taint %s\n", nodeInfo.Name, taint.ToString())
+	}
+}
+
+// roleTaintsExist returns the role labels whose taint is set on any node
+func roleTaintsExist(nodesInCluster map[string]v1.Node) map[string]bool {
+	tainted := map[string]bool{}
+	for _, nodeInfo := range nodesInCluster {
+		for label := range roleTaintKeys {
+			if hasRoleTaint(&nodeInfo, label) {
+				tainted[label] = true
+			}
+		}
+	}
+	return tainted
+}
+
+// desiredTolerations returns the tolerations with a toleration for every tainted role among the changed roles,
+// and without the tolerations of the changed roles that no node is tainted with anymore
+func desiredTolerations(tolerations []v1.Toleration, labels []string, taintedRoles map[string]bool) []v1.Toleration {
+	var result []v1.Toleration
+	for _, toleration := range tolerations {
+		if !isRoleToleration(toleration, labels) {
+			result = append(result, toleration)
+		}
+	}
+	for _, label := range labels {
+		if taintedRoles[label] {
+			result = append(result, roleToleration(label))
+		}
+	}
+	return result
+}
+
+func isRoleToleration(toleration v1.Toleration, labels []string) bool {
+	for _, label := range labels {
+		if toleration.Key == roleTaintKeys[label] {
+			return true
+		}
+	}
+	return false
+}
+
+// desiredConfigTolerations is desiredTolerations for the tolerations list of the RunaiConfig
+func desiredConfigTolerations(tolerations []interface{}, labels []string, taintedRoles map[string]bool) []interface{} {
+	var result []interface{}
+	for _, toleration := range tolerations {
+		if values, ok := toleration.(map[string]interface{}); ok && isRoleToleration(v1.Toleration{Key: fmt.Sprint(values["key"])}, labels) {
+			continue
+		}
+		result = append(result, toleration)
+	}
+	for _, label := range labels {
+		if taintedRoles[label] {
+			toleration := roleToleration(label)
+			result = append(result, map[string]interface{}{
+				"key":      toleration.Key,
+				"operator": string(toleration.Operator),
+				"value":    toleration.Value,
+				"effect":   string(toleration.Effect),
+			})
+		}
+	}
+	return result
+}
+
+func tolerationsEqual(a, b []interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,110 @@
+package noderole
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// nodeTargets selects the nodes a node-role command works on. A node is selected when it matches the label
+// selector, if one is given, and at least one of the name patterns, if any are given.
+type nodeTargets struct {
+	all      bool
+	selector labels.Selector
+	patterns []string
+	// the patterns that matched at least one node
+	matched map[string]bool
+}
+
+func hasNodeTargets(flags nodeRoleTypes, args []string) bool {
+	return len(args) > 0 || flags.AllNodes || flags.Selector != "" || flags.FromFile != ""
+}
+
+// newNodeTargets parses the selector and reads the name patterns of the node-role flags and arguments.
+// Patterns are node names or globs such as "gpu-pool-*". --all selects every node, so it cannot be combined with a
+// selector or patterns.
+func newNodeTargets(flags nodeRoleTypes, args []string) (*nodeTargets, error) {
+	if flags.AllNodes && (len(args) > 0 || flags.Selector != "" || flags.FromFile != "") {
+		return nil, fmt.Errorf("--all cannot be used together with node names, --selector or --from-file")
+	}
+	targets := &nodeTargets{all: flags.AllNodes, patterns: args, matched: map[string]bool{}}
+	if flags.Selector != "" {
+		selector, err := labels.Parse(flags.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %s: %v", flags.Selector, err)
+		}
+		targets.selector = selector
+	}
+	if flags.FromFile != "" {
+		names, err := readNodeNames(flags.FromFile)
+		if err != nil {
+			return nil, err
+		}
+		targets.patterns = append(targets.patterns, names...)
+	}
+	for _, pattern := range targets.patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid node name pattern %s: %v", pattern, err)
+		}
+	}
+	return targets, nil
+}
+
+// readNodeNames reads one node name or pattern per line, skipping empty lines and # comments
+func readNodeNames(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", filePath, err)
+	}
+	return names, nil
+}
+
+func (t *nodeTargets) matches(node *v1.Node) bool {
+	if t.all {
+		return true
+	}
+	if t.selector != nil && !t.selector.Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	if len(t.patterns) == 0 {
+		return t.selector != nil
+	}
+	found := false
+	for _, pattern := range t.patterns {
+		if matched, _ := path.Match(pattern, node.Name); matched {
+			t.matched[pattern] = true
+			found = true
+		}
+	}
+	return found
+}
+
+// unmatchedPatterns returns the name patterns that did not match any node
+func (t *nodeTargets) unmatchedPatterns() []string {
+	var unmatched []string
+	for _, pattern := range t.patterns {
+		if !t.matched[pattern] {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	return unmatched
+}
@@ -0,0 +1,56 @@
+package noderole
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeTargets(t *testing.T) {
+	nodes := []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu-1", Labels: map[string]string{"pool": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu-2", Labels: map[string]string{"pool": "b"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cpu-1", Labels: map[string]string{"pool": "a"}}},
+	}
+
+	tests := []struct {
+		name     string
+		flags    nodeRoleTypes
+		args     []string
+		expected []string
+		wantErr  bool
+	}{
+		{name: "all", flags: nodeRoleTypes{AllNodes: true}, expected: []string{"gpu-1", "gpu-2", "cpu-1"}},
+		{name: "selector", flags: nodeRoleTypes{Selector: "pool=a"}, expected: []string{"gpu-1", "cpu-1"}},
+		{name: "patterns", args: []string{"gpu-*"}, expected: []string{"gpu-1", "gpu-2"}},
+		{name: "selector and patterns", flags: nodeRoleTypes{Selector: "pool=a"}, args: []string{"gpu-*"}, expected: []string{"gpu-1"}},
+		{name: "nothing", expected: nil},
+		{name: "all and selector", flags: nodeRoleTypes{AllNodes: true, Selector: "pool=a"}, wantErr: true},
+		{name: "all and patterns", flags: nodeRoleTypes{AllNodes: true}, args: []string{"gpu-1"}, wantErr: true},
+		{name: "all and from file", flags: nodeRoleTypes{AllNodes: true, FromFile: "nodes.txt"}, wantErr: true},
+		{name: "invalid selector", flags: nodeRoleTypes{Selector: "a b"}, wantErr: true},
+		{name: "invalid pattern", args: []string{"gpu-["}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			targets, err := newNodeTargets(test.flags, test.args)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("newNodeTargets() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			var selected []string
+			for i := range nodes {
+				if targets.matches(&nodes[i]) {
+					selected = append(selected, nodes[i].Name)
+				}
+			}
+			if !reflect.DeepEqual(selected, test.expected) {
+				t.Errorf("selected %v, expected %v", selected, test.expected)
+			}
+		})
+	}
+}
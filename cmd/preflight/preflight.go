@@ -0,0 +1,227 @@
+package preflight
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type checkStatus string
+
+const (
+	statusPassed  checkStatus = "PASSED"
+	statusWarning checkStatus = "WARNING"
+	statusFailed  checkStatus = "FAILED"
+
+	minKubernetesMajor = 1
+	minKubernetesMinor = 16
+
+	defaultStorageClassAnnotation     = "storageclass.kubernetes.io/is-default-class"
+	betaDefaultStorageClassAnnotation = "storageclass.beta.kubernetes.io/is-default-class"
+)
+
+var runaiConfigCrdResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1beta1", Resource: "customresourcedefinitions"}
+
+type checkResult struct {
+	name    string
+	status  checkStatus
+	message string
+}
+
+type check struct {
+	name string
+	run  func(client *client.Client) (checkStatus, string)
+}
+
+var checks = []check{
+	{name: "Kubernetes version", run: checkServerVersion},
+	{name: "Nodes", run: checkNodes},
+	{name: "Default StorageClass", run: checkDefaultStorageClass},
+	{name: "Existing installation", run: checkExistingInstallation},
+	{name: "Create ClusterRoles", run: checkCanCreate("rbac.authorization.k8s.io", "clusterroles")},
+	{name: "Create CRDs", run: checkCanCreate("apiextensions.k8s.io", "customresourcedefinitions")},
+	{name: "Conflicting webhooks", run: checkConflictingWebhooks},
+}
+
+func Command() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "preflight",
+		Short: "Check that the cluster is ready for a Run:AI installation.",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := Run(client.GetClient()); err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			log.Info("All pre-flight checks passed")
+		},
+	}
+
+	return command
+}
+
+// Run runs all the pre-flight checks, prints their results and returns an error if any of them failed
+func Run(client *client.Client) error {
+	var results []checkResult
+	for _, check := range checks {
+		status, message := check.run(client)
+		results = append(results, checkResult{name: check.name, status: status, message: message})
+	}
+	printResults(results)
+
+	var failed []string
+	for _, result := range results {
+		if result.status == statusFailed {
+			failed = append(failed, result.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("pre-flight checks failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func printResults(results []checkResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "CHECK\tSTATUS\tMESSAGE\n")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.name, result.status, result.message)
+	}
+	w.Flush()
+}
+
+func checkServerVersion(client *client.Client) (checkStatus, string) {
+	serverVersion, err := client.GetClientset().Discovery().ServerVersion()
+	if err != nil {
+		return statusFailed, fmt.Sprintf("failed to get server version: %v", err)
+	}
+	major, errMajor := strconv.Atoi(strings.TrimSuffix(serverVersion.Major, "+"))
+	minor, errMinor := strconv.Atoi(strings.TrimSuffix(serverVersion.Minor, "+"))
+	if errMajor != nil || errMinor != nil {
+		return statusWarning, fmt.Sprintf("could not parse server version %s", serverVersion.GitVersion)
+	}
+	if major < minKubernetesMajor || (major == minKubernetesMajor && minor < minKubernetesMinor) {
+		return statusFailed, fmt.Sprintf("server version %s is older than the minimum supported %d.%d", serverVersion.GitVersion, minKubernetesMajor, minKubernetesMinor)
+	}
+	return statusPassed, serverVersion.GitVersion
+}
+
+func checkNodes(client *client.Client) (checkStatus, string) {
+	nodes, err := client.GetClientset().CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return statusFailed, fmt.Sprintf("failed to list nodes: %v", err)
+	}
+	if len(nodes.Items) == 0 {
+		return statusFailed, "no nodes found in the cluster"
+	}
+	return statusPassed, fmt.Sprintf("%d nodes found", len(nodes.Items))
+}
+
+func checkDefaultStorageClass(client *client.Client) (checkStatus, string) {
+	storageClasses, err := client.GetClientset().StorageV1().StorageClasses().List(metav1.ListOptions{})
+	if err != nil {
+		return statusFailed, fmt.Sprintf("failed to list storage classes: %v", err)
+	}
+	for _, storageClass := range storageClasses.Items {
+		if storageClass.Annotations[defaultStorageClassAnnotation] == "true" || storageClass.Annotations[betaDefaultStorageClassAnnotation] == "true" {
+			return statusPassed, storageClass.Name
+		}
+	}
+	return statusFailed, "no default StorageClass found"
+}
+
+func checkExistingInstallation(client *client.Client) (checkStatus, string) {
+	var found []string
+	_, err := client.GetClientset().CoreV1().Namespaces().Get(common.RunaiNamespace, metav1.GetOptions{})
+	if err == nil {
+		found = append(found, fmt.Sprintf("namespace %s", common.RunaiNamespace))
+	} else if !apierrors.IsNotFound(err) {
+		return statusFailed, fmt.Sprintf("failed to get namespace %s: %v", common.RunaiNamespace, err)
+	}
+
+	_, err = client.GetDynamicClient().Resource(runaiConfigCrdResource).Get(common.RunaiConfigCrdName, metav1.GetOptions{})
+	if err == nil {
+		found = append(found, fmt.Sprintf("CRD %s", common.RunaiConfigCrdName))
+	} else if !apierrors.IsNotFound(err) {
+		return statusFailed, fmt.Sprintf("failed to get CRD %s: %v", common.RunaiConfigCrdName, err)
+	}
+
+	if len(found) > 0 {
+		return statusWarning, fmt.Sprintf("found %s, install will update the existing installation", strings.Join(found, " and "))
+	}
+	return statusPassed, "no existing installation found"
+}
+
+func checkCanCreate(group, resource string) func(client *client.Client) (checkStatus, string) {
+	return func(client *client.Client) (checkStatus, string) {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Verb:     "create",
+					Group:    group,
+					Resource: resource,
+				},
+			},
+		}
+		review, err := client.GetClientset().AuthorizationV1().SelfSubjectAccessReviews().Create(review)
+		if err != nil {
+			return statusFailed, fmt.Sprintf("failed to review access: %v", err)
+		}
+		if !review.Status.Allowed {
+			return statusFailed, fmt.Sprintf("not allowed to create %s.%s %s", resource, group, review.Status.Reason)
+		}
+		return statusPassed, fmt.Sprintf("allowed to create %s", resource)
+	}
+}
+
+// checkConflictingWebhooks looks for Run:AI webhooks left over from a previous installation. When the
+// runai namespace does not exist their services are gone, and they may reject the pods of the new installation.
+func checkConflictingWebhooks(client *client.Client) (checkStatus, string) {
+	_, err := client.GetClientset().CoreV1().Namespaces().Get(common.RunaiNamespace, metav1.GetOptions{})
+	if err == nil {
+		return statusPassed, fmt.Sprintf("namespace %s exists, webhooks belong to the existing installation", common.RunaiNamespace)
+	}
+
+	var conflicts []string
+	mutating, err := client.GetClientset().AdmissionregistrationV1beta1().MutatingWebhookConfigurations().List(metav1.ListOptions{})
+	if err != nil {
+		return statusFailed, fmt.Sprintf("failed to list mutating webhooks: %v", err)
+	}
+	for _, configuration := range mutating.Items {
+		for _, webhook := range configuration.Webhooks {
+			if webhook.ClientConfig.Service != nil && webhook.ClientConfig.Service.Namespace == common.RunaiNamespace {
+				conflicts = append(conflicts, "MutatingWebhookConfiguration/"+configuration.Name)
+				break
+			}
+		}
+	}
+
+	validating, err := client.GetClientset().AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().List(metav1.ListOptions{})
+	if err != nil {
+		return statusFailed, fmt.Sprintf("failed to list validating webhooks: %v", err)
+	}
+	for _, configuration := range validating.Items {
+		for _, webhook := range configuration.Webhooks {
+			if webhook.ClientConfig.Service != nil && webhook.ClientConfig.Service.Namespace == common.RunaiNamespace {
+				conflicts = append(conflicts, "ValidatingWebhookConfiguration/"+configuration.Name)
+				break
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return statusFailed, fmt.Sprintf("webhooks of a previous installation found, run uninstall first: %s", strings.Join(conflicts, ", "))
+	}
+	return statusPassed, "no conflicting webhooks found"
+}
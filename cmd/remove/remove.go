@@ -30,6 +30,7 @@ func Command() *cobra.Command {
 	}
 
 	command.AddCommand(noderole.Remove())
+	command.AddCommand(noderole.RemoveNodePool())
 	command.AddCommand(secret.Remove())
 
 	return command
@@ -0,0 +1,44 @@
+package restore
+
+import (
+	"os"
+
+	"github.com/run-ai/runai-cli/cmd/backup"
+	"github.com/run-ai/runai-cli/cmd/lock"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type restoreFlags struct {
+	filePath     string
+	withDatabase bool
+}
+
+func Command() *cobra.Command {
+	restoreFlags := restoreFlags{}
+	var command = &cobra.Command{
+		Use:         "restore",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Short:       "Restore the Run:AI state from a backup archive created by upgrade.",
+		Args:        cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			if restoreFlags.filePath == "" {
+				log.Error("No backup archive was provided")
+				cmd.HelpFunc()(cmd, args)
+				os.Exit(1)
+			}
+
+			if err := backup.Restore(client.GetClient(), restoreFlags.filePath, restoreFlags.withDatabase); err != nil {
+				log.Errorf("Failed to restore, error: %v", err)
+				os.Exit(1)
+			}
+			log.Infof("Successfully restored from %s", restoreFlags.filePath)
+		},
+	}
+
+	command.Flags().StringVarP(&restoreFlags.filePath, "file", "f", "", "Path of a Run:AI backup archive")
+	command.Flags().BoolVar(&restoreFlags.withDatabase, "with-db", false, "Restore the runai-db contents from the archive")
+
+	return command
+}
@@ -15,9 +15,15 @@
 package root
 
 import (
+	"github.com/run-ai/runai-cli/cmd/apply"
+	"github.com/run-ai/runai-cli/cmd/controller"
 	getversion "github.com/run-ai/runai-cli/cmd/get"
 	"github.com/run-ai/runai-cli/cmd/install"
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/cmd/lock"
+	"github.com/run-ai/runai-cli/cmd/preflight"
 	"github.com/run-ai/runai-cli/cmd/remove"
+	"github.com/run-ai/runai-cli/cmd/restore"
 	"github.com/run-ai/runai-cli/cmd/set"
 	"github.com/run-ai/runai-cli/cmd/uninstall"
 	"github.com/run-ai/runai-cli/cmd/update"
@@ -43,6 +49,12 @@ func NewCommand() *cobra.Command {
 		// Would be run before any child command
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 			util.SetLogLevel(LogLevel)
+			if lock.Required(cmd) {
+				lock.AcquireOrExit(cmd)
+			}
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			lock.ReleaseHeld()
 		},
 	}
 
@@ -51,12 +63,20 @@ func NewCommand() *cobra.Command {
 
 	command.AddCommand(set.Command())
 	command.AddCommand(remove.Command())
+	command.AddCommand(apply.Command())
+	command.AddCommand(controller.Command())
 	command.AddCommand(upgrade.Command())
+	command.AddCommand(upgrade.Rollback())
 	command.AddCommand(version.Command())
 	command.AddCommand(update.Command())
 	command.AddCommand(getversion.Command())
 	command.AddCommand(install.Command())
+	command.AddCommand(preflight.Command())
+	command.AddCommand(restore.Command())
 	command.AddCommand(uninstall.Command())
+	command.AddCommand(journal.Resume())
+	command.AddCommand(journal.Abort())
+	command.AddCommand(lock.Command())
 
 	return command
 }
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/lock"
 	"github.com/run-ai/runai-cli/pkg/client"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -14,17 +16,14 @@ type nodeRoleTypes struct {
 	ClusterWide bool
 }
 
-const (
-	clusterWideSecretLabel = "runai/cluster-wide"
-)
-
 func Set() *cobra.Command {
 	flags := nodeRoleTypes{}
 	var command = &cobra.Command{
-		Use:     "secret SECRET_NAME",
-		Aliases: []string{"secrets"},
-		Short:   "Set Secret resource",
-		Args:    cobra.MinimumNArgs(1),
+		Use:         "secret SECRET_NAME",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Aliases:     []string{"secrets"},
+		Short:       "Set Secret resource",
+		Args:        cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if cmd.Flags().NFlag() == 0 {
 				fmt.Println("No flags were provided")
@@ -46,10 +45,11 @@ func Set() *cobra.Command {
 func Remove() *cobra.Command {
 	flags := nodeRoleTypes{}
 	var command = &cobra.Command{
-		Use:     "secret SECRET_NAME",
-		Aliases: []string{"secrets"},
-		Short:   "Remove Secret resource",
-		Args:    cobra.MinimumNArgs(1),
+		Use:         "secret SECRET_NAME",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Aliases:     []string{"secrets"},
+		Short:       "Remove Secret resource",
+		Args:        cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if cmd.Flags().NFlag() == 0 {
 				fmt.Println("No flags were provided")
@@ -84,11 +84,11 @@ func updateSecrets(client *client.Client, args []string, shouldAddSecret bool) {
 			if secretInfo.Labels == nil {
 				secretInfo.Labels = map[string]string{}
 			}
-			delete(secretInfo.Labels, clusterWideSecretLabel)
+			delete(secretInfo.Labels, common.ClusterWideSecretLabel)
 			if shouldAddSecret {
-				secretInfo.Labels[clusterWideSecretLabel] = "true"
+				secretInfo.Labels[common.ClusterWideSecretLabel] = "true"
 			} else {
-				delete(secretInfo.Labels, clusterWideSecretLabel)
+				delete(secretInfo.Labels, common.ClusterWideSecretLabel)
 			}
 			secretsToUpdateMap[secretInfo.Name] = true
 			_, err = client.GetClientset().CoreV1().Secrets("runai").Update(&secretInfo)
@@ -30,6 +30,7 @@ func Command() *cobra.Command {
 	}
 
 	command.AddCommand(noderole.Set())
+	command.AddCommand(noderole.SetNodePool())
 	command.AddCommand(secret.Set())
 
 	return command
@@ -0,0 +1,37 @@
+package uninstall
+
+import (
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	"github.com/run-ai/runai-cli/pkg/kube"
+	log "github.com/sirupsen/logrus"
+)
+
+const helmReleaseResource = "helmreleases.helm.fluxcd.io"
+
+// collectBackendObjects returns the HelmReleases of the backend, which the helm-operator purges on deletion,
+// and the helm-operator deployment, which must therefore only be deleted after the HelmReleases are gone
+func collectBackendObjects(client *client.Client) (helmReleases []kube.Object, helmOperator []kube.Object) {
+	helmReleases, err := kube.List(client, helmReleaseResource, common.RunaiBackendNamespace, "")
+	if err != nil {
+		log.Debugf("Failed to list %s: %v", helmReleaseResource, err)
+	}
+	helmOperator = listNamed(client, "deployments", common.RunaiBackendNamespace, []string{common.RunaiBackendOperatorDeploymentName})
+	return helmReleases, helmOperator
+}
+
+// uninstallBackend deletes the backend HelmReleases and waits for the helm-operator to purge them,
+// then deletes the helm-operator and the runai-backend namespace
+func uninstallBackend(client *client.Client, helmReleases, helmOperator []kube.Object, uninstallFlags uninstallFlags) (*uninstallSummary, error) {
+	summary := deleteObjects(client, helmReleases)
+	if uninstallFlags.timeout > 0 {
+		if err := waitForTermination(client, helmReleases, uninstallFlags); err != nil {
+			return summary, err
+		}
+	}
+
+	operatorSummary := deleteObjects(client, helmOperator)
+	summary.merge(operatorSummary)
+	deleteNamespace(client, common.RunaiBackendNamespace)
+	return summary, nil
+}
@@ -0,0 +1,160 @@
+package uninstall
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	"github.com/run-ai/runai-cli/pkg/kube"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// component is an optional part of the Run:AI cluster that can be uninstalled on its own
+type component struct {
+	// the keys of the RunaiConfig values of the component, disabled so that the operator does not recreate it
+	valuesKeys []string
+	// the name prefixes of the objects of the component, made of the name of the runai release
+	namePrefixes []string
+	// the name prefixes that other installations use as well, e.g. the default name of the kube-prometheus-stack
+	// chart, whose objects are of the component only in the runai namespace or when they are owned by Run:AI
+	ownedNamePrefixes []string
+}
+
+// CRDs are never deleted with a component, as their deletion would delete the custom resources of every
+// installation that shares them, e.g. the ServiceMonitors of a Prometheus that the cluster already runs
+var components = map[string]component{
+	"monitoring": {
+		valuesKeys: []string{"prometheus-operator", "kube-prometheus-stack", "prometheus-pushgateway", "grafana"},
+		namePrefixes: []string{"runai-prometheus-operator", "prometheus-runai-prometheus-operator", "runai-kube-prometheus-stac",
+			"runai-prometheus-pushgateway", "storage-volume-runai-prometheus-pushgateway", "runai-grafana",
+			"runai-kube-state-metrics", "psp-runai-kube-state-metrics", "runai-prometheus-node-exporter", "psp-runai-prometheus-node-exporter"},
+		ownedNamePrefixes: []string{"kube-prometheus-stack", "prom-kube-prometheus-stack"},
+	},
+	"nvidia-device-plugin": {
+		valuesKeys:   []string{"nvidia-device-plugin"},
+		namePrefixes: []string{"runai-nvidia-device-plugin"},
+	},
+	"mpi-operator": {
+		valuesKeys:        []string{"mpi-operator"},
+		ownedNamePrefixes: []string{"mpi-operator"},
+	},
+	"nfd": {
+		valuesKeys:        []string{"node-feature-discovery"},
+		namePrefixes:      []string{"runai-node-feature-discovery"},
+		ownedNamePrefixes: []string{"nfd-master", "nfd-worker"},
+	},
+}
+
+// the resources in the runai namespace that components are made of
+var componentNamespacedResources = []string{"deployments", "daemonsets", "statefulsets", "jobs", "persistentvolumeclaims", "services",
+	"serviceaccounts", "configmaps", "secrets", "roles", "rolebindings", "servicemonitors", "prometheusrules", "prometheuses", "alertmanagers"}
+
+func componentNames() []string {
+	var names []string
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateComponents(names []string) error {
+	for _, name := range names {
+		if _, found := components[name]; !found {
+			return fmt.Errorf("unknown component %s, supported components are: %s", name, strings.Join(componentNames(), ", "))
+		}
+	}
+	return nil
+}
+
+func (c component) matches(obj *kube.Object) bool {
+	if obj.GetKind() == "CustomResourceDefinition" {
+		return false
+	}
+	for _, prefix := range c.namePrefixes {
+		if strings.HasPrefix(obj.GetName(), prefix) {
+			return true
+		}
+	}
+	for _, prefix := range c.ownedNamePrefixes {
+		if strings.HasPrefix(obj.GetName(), prefix) && (obj.GetNamespace() == common.RunaiNamespace || isOwnedByRunai(&obj.Unstructured)) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectComponentObjects returns the objects of the components, in the runai namespace and the Run:AI owned ones in
+// the cluster. The names of legacy installations are not used, they include the default names of charts that the
+// cluster may run on its own.
+func collectComponentObjects(client *client.Client, names []string) []kube.Object {
+	var candidates []kube.Object
+	for _, resource := range componentNamespacedResources {
+		namespaced, err := kube.List(client, resource, common.RunaiNamespace, "")
+		if err != nil {
+			log.Debugf("Failed to list %s: %v", resource, err)
+			continue
+		}
+		candidates = append(candidates, namespaced...)
+	}
+	candidates = append(candidates, findOwnedResources(client)...)
+
+	seen := map[string]bool{}
+	var objects []kube.Object
+	for i := range candidates {
+		obj := &candidates[i]
+		if seen[obj.Ref()] {
+			continue
+		}
+		for _, name := range names {
+			if components[name].matches(obj) {
+				seen[obj.Ref()] = true
+				objects = append(objects, *obj)
+				break
+			}
+		}
+	}
+	return objects
+}
+
+// disableComponents disables the components in the RunaiConfig so that the operator does not recreate them
+func disableComponents(client *client.Client, names []string) error {
+	values := map[string]interface{}{}
+	for _, name := range names {
+		for _, key := range components[name].valuesKeys {
+			values[key] = map[string]interface{}{"enabled": false}
+		}
+	}
+	patch, err := json.Marshal(map[string]interface{}{"spec": values})
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		_, err = client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Patch(common.RunaiConfigName, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err == nil {
+			break
+		}
+		log.Debugf("Failed to update runaiconfig, attempt: %v, error: %v", i, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to disable %s in the RunaiConfig: %v", strings.Join(names, ", "), err)
+	}
+	log.Infof("Disabled %s in the RunaiConfig", strings.Join(names, ", "))
+	return nil
+}
+
+func printDisabledValues(names []string) {
+	fmt.Println("RunaiConfig values to disable:")
+	for _, name := range names {
+		for _, key := range components[name].valuesKeys {
+			fmt.Printf("    spec.%s.enabled: false\n", key)
+		}
+	}
+	fmt.Println()
+}
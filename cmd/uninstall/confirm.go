@@ -0,0 +1,133 @@
+package uninstall
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/lock"
+	"github.com/run-ai/runai-cli/pkg/client"
+	"github.com/run-ai/runai-cli/pkg/kube"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// printObjectsByKind prints the objects uninstall would delete, grouped by kind
+func printObjectsByKind(objects []kube.Object, uninstallFlags uninstallFlags) {
+	byKind := map[string][]string{}
+	for i := range objects {
+		byKind[objects[i].GetKind()] = append(byKind[objects[i].GetKind()], objectName(&objects[i].Unstructured))
+	}
+	if uninstallFlags.deleteAll {
+		byKind["RunaiConfig"] = append(byKind["RunaiConfig"], common.RunaiNamespace+"/"+common.RunaiConfigName)
+		byKind["Namespace"] = append(byKind["Namespace"], common.RunaiNamespace)
+	}
+	if uninstallFlags.backend {
+		byKind["Namespace"] = append(byKind["Namespace"], common.RunaiBackendNamespace)
+	}
+
+	var kinds []string
+	for kind := range byKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	total := 0
+	for _, kind := range kinds {
+		names := byKind[kind]
+		sort.Strings(names)
+		fmt.Printf("%s (%d):\n", kind, len(names))
+		for _, name := range names {
+			fmt.Printf("    %s\n", name)
+		}
+		total += len(names)
+	}
+	fmt.Printf("\n%d objects would be deleted\n", total)
+}
+
+func objectName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// confirmUninstall shows what the uninstall would destroy on which cluster and asks the user to confirm
+func confirmUninstall(client *client.Client, objects []kube.Object, uninstallFlags uninstallFlags) bool {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Context:\t%s\n", client.GetCurrentContext())
+	fmt.Fprintf(w, "Cluster:\t%s\n", client.GetRestConfig().Host)
+	fmt.Fprintf(w, "Objects to delete:\t%d\n", len(objects))
+	fmt.Fprintf(w, "Projects to delete:\t%s\n", countObjects(client, "projects.run.ai", nil))
+	fmt.Fprintf(w, "Departments to delete:\t%s\n", countObjects(client, "departments", nil))
+	fmt.Fprintf(w, "Running RunaiJobs to delete:\t%s\n", countObjects(client, "runaijobs.run.ai", isRunning))
+	if uninstallFlags.deleteAll {
+		fmt.Fprintf(w, "Namespace to delete:\t%s\n", common.RunaiNamespace)
+	}
+	w.Flush()
+
+	return askForConfirmation("uninstall Run:AI from this cluster")
+}
+
+// confirmPartialUninstall shows which part of Run:AI would be uninstalled from which cluster and asks the user to confirm
+func confirmPartialUninstall(client *client.Client, what string, objects []kube.Object) bool {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Context:\t%s\n", client.GetCurrentContext())
+	fmt.Fprintf(w, "Cluster:\t%s\n", client.GetRestConfig().Host)
+	fmt.Fprintf(w, "Uninstall:\t%s\n", what)
+	fmt.Fprintf(w, "Objects to delete:\t%d\n", len(objects))
+	w.Flush()
+
+	return askForConfirmation("uninstall " + what)
+}
+
+// askForConfirmation returns false when the user answers anything but yes, or when there is no answer, e.g. in a
+// script without --yes
+func askForConfirmation(action string) bool {
+	fmt.Printf("\nType 'yes' to %s: ", action)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
+
+// exitAborted exits with an error when the uninstall was not confirmed, so that scripts do not take it for success
+func exitAborted() {
+	log.Error("Uninstall was aborted")
+	lock.ReleaseHeld()
+	os.Exit(1)
+}
+
+func countObjects(client *client.Client, resource string, filter func(obj *unstructured.Unstructured) bool) string {
+	objects, err := kube.List(client, resource, "", "")
+	if err != nil {
+		return "unknown"
+	}
+	count := 0
+	for i := range objects {
+		if filter == nil || filter(&objects[i].Unstructured) {
+			count++
+		}
+	}
+	return fmt.Sprint(count)
+}
+
+// isRunning checks whether a RunaiJob has neither completed nor failed
+func isRunning(obj *unstructured.Unstructured) bool {
+	if _, found, _ := unstructured.NestedString(obj.Object, "status", "completionTime"); found {
+		return false
+	}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if (conditionMap["type"] == "Complete" || conditionMap["type"] == "Failed") && conditionMap["status"] == "True" {
+			return false
+		}
+	}
+	return true
+}
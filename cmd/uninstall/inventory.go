@@ -0,0 +1,204 @@
+package uninstall
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	"github.com/run-ai/runai-cli/pkg/kube"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	partOfLabel            = "app.kubernetes.io/part-of"
+	managedByLabel         = "app.kubernetes.io/managed-by"
+	releaseLabel           = "release"
+	helmReleaseNamespace   = "meta.helm.sh/release-namespace"
+	runaiOwnerGroup        = "run.ai"
+	runaiOperatorManagedBy = "runai-operator"
+)
+
+var runaiPvcs = []string{"data-runai-db-0", "prometheus-runai-prometheus-operator-prometheus-db-prometheus-runai-prometheus-operator-prometheus-0", "storage-volume-runai-prometheus-pushgateway-0"}
+
+// namespaced resources outside of the runai namespace that Run:AI creates
+var foreignNamespaceResources = []struct {
+	resource  string
+	namespace string
+}{
+	{resource: "services", namespace: "kube-system"},
+}
+
+// legacyResources are the cluster resources of installations that predate ownership labels,
+// used only when no labelled resources are found
+var legacyResources = []struct {
+	resource  string
+	namespace string
+	names     []string
+}{
+	{resource: "psp", names: []string{"mpi-operator", "nfd-master", "runai-admission-controller", "runai-grafana", "runai-grafana-test", "runai-init-ca", "runai-job-controller", "runai-job-executor", "runai-job-viewer", "runai-kube-prometheus-stac-prometheus", "runai-kube-state-metrics", "runai-local-path-provisioner", "runai-nginx-ingress", "runai-nginx-ingress-backend", "runai-project-controller", "runai-prometheus-node-exporter", "runai-prometheus-operator-admission", "runai-prometheus-operator-operator", "runai-prometheus-operator-prometheus", "runai-prometheus-pushgateway"}},
+	{resource: "clusterrole", names: []string{"init-ca", "mpi-operator", "nfd-master", "psp-runai-kube-state-metrics", "psp-runai-prometheus-node-exporter", "researcher-service", "researcher-service-ro", "runai", "runai-admission-controller", "runai-admission-controller-project", "runai-admission-controller-ro", "runai-agent", "runai-cli-index-map-editor", "runai-fluentd", "runai-grafana-clusterrole", "runai-job-controller", "runai-job-controller-project", "runai-job-executor", "runai-job-viewer", "runai-kube-prometheus-stac-operator", "runai-kube-prometheus-stac-operator-psp", "runai-kube-prometheus-stac-prometheus", "runai-kube-prometheus-stac-prometheus-psp", "runai-kube-state-metrics", "runai-local-path-provisioner", "runai-nfs-client-provisioner-runner", "runai-nginx-ingress", "runai-nvidia-device-plugin", "runai-operator", "runai-project-controller", "runai-project-controller-administrator", "runai-project-controller-cluster-secret", "runai-project-controller-cluster-secret-per-project", "runai-project-controller-project", "runai-prometheus-operator-operator", "runai-prometheus-operator-operator-psp", "runai-prometheus-operator-prometheus", "runai-prometheus-operator-prometheus-psp", "runai-scheduler-ro", "runai-scheduler-rw"}},
+	{resource: "clusterrolebinding", names: []string{"default-sa-admin", "init-ca", "mpi-operator", "nfd-master", "psp-runai-kube-state-metrics", "psp-runai-prometheus-node-exporter", "researcher-service", "researcher-service-ro", "run-runai-nfs-client-provisioner", "runai", "runai-admission-controller", "runai-admission-controller-ro", "runai-agent", "runai-fluentd", "runai-grafana-clusterrolebinding", "runai-job-controller", "runai-job-executor", "runai-job-viewer", "runai-job-viewer-manual", "runai-kube-prometheus-stac-operator", "runai-kube-prometheus-stac-operator-psp", "runai-kube-prometheus-stac-prometheus", "runai-kube-prometheus-stac-prometheus-psp", "runai-kube-state-metrics", "runai-local-path-provisioner", "runai-nginx-ingress", "runai-nvidia-device-plugin", "runai-operator", "runai-project-controller", "runai-project-controller-administrator", "runai-project-controller-cluster-secret", "runai-prometheus-operator-operator", "runai-prometheus-operator-operator-psp", "runai-prometheus-operator-prometheus", "runai-prometheus-operator-prometheus-psp", "runai-scheduler-ro", "runai-scheduler-rw"}},
+	{resource: "mutatingwebhookconfigurations", names: []string{"runai-fractional-gpus", "runai-kube-prometheus-stac-admission", "runai-label-project", "runai-mutating-webhook", "runai-node-affinity", "runai-prometheus-operator-admission", "runai-reporter-library", "runai-resource-gpu-factor"}},
+	{resource: "validatingwebhookconfigurations", names: []string{"runai-kube-prometheus-stac-admission", "runai-prometheus-operator-admission", "runai-validate-elastic", "runai-validate-fractional"}},
+	{resource: "pc", names: []string{"build", "interactive-preemptible", "runai-critical", "train"}},
+	{resource: "crd", names: []string{"departments.scheduling.incubator.k8s.io", "podgroups.scheduling.incubator.k8s.io", "projects.run.ai", "prometheuses.monitoring.coreos.com", "queues.scheduling.incubator.k8s.io", "runaijobs.run.ai"}},
+	{resource: "sc", names: []string{"local-path", "nfs-client"}},
+	{resource: "services", namespace: "kube-system", names: []string{"kube-prometheus-stack-kubelet", "prom-kube-prometheus-stack-kubelet", "runai-kube-prometheus-stac-kubelet", "runai-prometheus-operator-coredns", "runai-prometheus-operator-kube-controller-manager", "runai-prometheus-operator-kube-etcd", "runai-prometheus-operator-kube-proxy", "runai-prometheus-operator-kube-scheduler", "runai-prometheus-operator-kubelet"}},
+}
+
+// isOwnedByRunai checks the ownership labels, the helm release annotation and the owner references of an object
+func isOwnedByRunai(obj *unstructured.Unstructured) bool {
+	labels := obj.GetLabels()
+	if labels[partOfLabel] == "runai" || labels[managedByLabel] == runaiOperatorManagedBy || labels[releaseLabel] == "runai" {
+		return true
+	}
+	if obj.GetAnnotations()[helmReleaseNamespace] == common.RunaiNamespace {
+		return true
+	}
+	for _, owner := range obj.GetOwnerReferences() {
+		if strings.SplitN(owner.APIVersion, "/", 2)[0] == runaiOwnerGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// findOwnedResources returns the Run:AI owned objects outside of the runai namespace
+func findOwnedResources(client *client.Client) []kube.Object {
+	owned, err := kube.ListClusterScoped(client, isOwnedByRunai)
+	if err != nil {
+		log.Debugf("Some cluster resources could not be listed: %v", err)
+	}
+	for _, foreign := range foreignNamespaceResources {
+		objects, err := kube.List(client, foreign.resource, foreign.namespace, "")
+		if err != nil {
+			log.Debugf("Failed to list %s in %s: %v", foreign.resource, foreign.namespace, err)
+			continue
+		}
+		for _, obj := range objects {
+			if isOwnedByRunai(&obj.Unstructured) {
+				owned = append(owned, obj)
+			}
+		}
+	}
+	return owned
+}
+
+// collectUninstallObjects returns the objects uninstall deletes, in the order they are deleted.
+// The RunaiConfig and the runai namespace are deleted separately and are not part of the list.
+func collectUninstallObjects(client *client.Client, uninstallFlags uninstallFlags) []kube.Object {
+	var objects []kube.Object
+	for _, resource := range []string{"deployments", "daemonsets", "statefulsets", "jobs"} {
+		namespaced, err := kube.List(client, resource, common.RunaiNamespace, "")
+		if err != nil {
+			log.Debugf("Failed to list %s: %v", resource, err)
+			continue
+		}
+		for _, obj := range namespaced {
+			if !uninstallFlags.deleteAll && obj.GetKind() == "Deployment" && obj.GetName() == common.RunaiOperatorDeploymentName {
+				log.Infof("Keeping RunAI Operator with 0 replicas")
+				continue
+			}
+			objects = append(objects, obj)
+		}
+	}
+	objects = append(objects, listNamed(client, "persistentvolumeclaims", common.RunaiNamespace, runaiPvcs)...)
+
+	owned := findOwnedResources(client)
+	if len(owned) == 0 {
+		log.Infof("No labelled Run:AI resources were found, deleting the resources of a legacy installation")
+		for _, legacy := range legacyResources {
+			owned = append(owned, listNamed(client, legacy.resource, legacy.namespace, legacy.names)...)
+		}
+	}
+	objects = append(objects, owned...)
+
+	objects = append(objects, listNamed(client, "departments", "", []string{"default"})...)
+	for _, resource := range []string{"roles", "services", "serviceaccounts", "servicemonitors", "rolebindings"} {
+		namespaced, err := kube.List(client, resource, common.RunaiNamespace, "")
+		if err != nil {
+			log.Debugf("Failed to list %s: %v", resource, err)
+			continue
+		}
+		objects = append(objects, namespaced...)
+	}
+	return objects
+}
+
+// listNamed returns the objects of a resource that exist out of the given names
+func listNamed(client *client.Client, resource, namespace string, names []string) []kube.Object {
+	objects, err := kube.List(client, resource, namespace, "")
+	if err != nil {
+		log.Debugf("Failed to list %s: %v", resource, err)
+		return nil
+	}
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var found []kube.Object
+	for _, obj := range objects {
+		if wanted[obj.GetName()] {
+			found = append(found, obj)
+		}
+	}
+	return found
+}
+
+func deleteObjects(client *client.Client, objects []kube.Object) *uninstallSummary {
+	summary := &uninstallSummary{}
+	for i := range objects {
+		obj := &objects[i]
+		if obj.GetDeletionTimestamp() != nil {
+			summary.skipped = append(summary.skipped, obj.Ref()+" (already being deleted)")
+			continue
+		}
+		summary.addResult(obj.Ref(), kube.DeleteObject(client, obj))
+	}
+	return summary
+}
+
+type uninstallSummary struct {
+	deleted []string
+	skipped []string
+	failed  []string
+}
+
+func (s *uninstallSummary) addResult(ref string, err error) {
+	switch {
+	case apierrors.IsNotFound(err):
+		s.skipped = append(s.skipped, ref+" (not found)")
+	case err != nil:
+		s.failed = append(s.failed, fmt.Sprintf("%s (%v)", ref, err))
+	default:
+		s.deleted = append(s.deleted, ref)
+	}
+}
+
+func (s *uninstallSummary) merge(other *uninstallSummary) {
+	s.deleted = append(s.deleted, other.deleted...)
+	s.skipped = append(s.skipped, other.skipped...)
+	s.failed = append(s.failed, other.failed...)
+}
+
+func (s *uninstallSummary) print() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\nRESULT\tOBJECT\n")
+	for _, group := range []struct {
+		result string
+		refs   []string
+	}{{"deleted", s.deleted}, {"skipped", s.skipped}, {"failed", s.failed}} {
+		sort.Strings(group.refs)
+		for _, ref := range group.refs {
+			fmt.Fprintf(w, "%s\t%s\n", group.result, ref)
+		}
+	}
+	w.Flush()
+	fmt.Printf("\nDeleted: %d, skipped: %d, failed: %d\n", len(s.deleted), len(s.skipped), len(s.failed))
+}
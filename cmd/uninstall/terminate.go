@@ -0,0 +1,307 @@
+package uninstall
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/run-ai/runai-cli/pkg/client"
+	"github.com/run-ai/runai-cli/pkg/kube"
+	log "github.com/sirupsen/logrus"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	defaultTerminationTimeout = 2 * time.Minute
+	terminationPollInterval   = 5 * time.Second
+)
+
+var (
+	namespaceResource  = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	apiServiceResource = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+)
+
+// blocker is an object, or a cluster condition, that keeps a deleted object from terminating
+type blocker struct {
+	ref    string
+	reason string
+}
+
+// waitForTermination waits for the deleted objects to be gone. On timeout the objects that block the termination are
+// reported and, when --force-finalizers is set, their finalizers are cleared and the termination is waited for again.
+func waitForTermination(client *client.Client, objects []kube.Object, flags uninstallFlags) error {
+	pending := terminatingObjects(client, objects)
+	if len(pending) == 0 {
+		return nil
+	}
+	log.Infof("Waiting up to %v for %d objects to terminate", flags.timeout, len(pending))
+	pending = waitForDeletions(client, pending, flags.timeout)
+	if len(pending) == 0 {
+		return nil
+	}
+
+	printBlockers(findBlockers(client, pending))
+	if !flags.forceFinalizers {
+		return fmt.Errorf("timed out after %v, %d objects are still terminating: %s. Fix the reported causes, or run uninstall again with --force-finalizers to clear the finalizers",
+			flags.timeout, len(pending), strings.Join(objectRefs(pending), ", "))
+	}
+
+	log.Warnf("Clearing the finalizers of the terminating objects, the cleanup their controllers would have done is skipped")
+	forceFinalizers(client, pending)
+	pending = waitForDeletions(client, pending, flags.timeout)
+	if len(pending) > 0 {
+		return fmt.Errorf("%d objects are still terminating after clearing their finalizers: %s", len(pending), strings.Join(objectRefs(pending), ", "))
+	}
+	return nil
+}
+
+// terminatingObjects returns the current state of the objects that exist and are being deleted
+func terminatingObjects(client *client.Client, objects []kube.Object) []kube.Object {
+	var terminating []kube.Object
+	for i := range objects {
+		current, err := kube.GetObject(client, &objects[i])
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			log.Debugf("Failed to get %s: %v", objects[i].Ref(), err)
+			terminating = append(terminating, objects[i])
+			continue
+		}
+		if current.GetDeletionTimestamp() != nil {
+			terminating = append(terminating, *current)
+		}
+	}
+	return terminating
+}
+
+func waitForDeletions(client *client.Client, pending []kube.Object, timeout time.Duration) []kube.Object {
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := terminatingObjects(client, pending)
+		if len(remaining) != len(pending) {
+			log.Infof("%d objects are still terminating", len(remaining))
+		}
+		pending = remaining
+		if len(pending) == 0 || time.Now().After(deadline) {
+			return pending
+		}
+		time.Sleep(terminationPollInterval)
+	}
+}
+
+// findBlockers explains why the pending objects are not gone: their finalizers, the conditions and contents of
+// terminating namespaces, unavailable APIServices that fail the namespace content discovery, and webhooks whose
+// service is gone so that they reject the updates that remove finalizers
+func findBlockers(client *client.Client, pending []kube.Object) []blocker {
+	var blockers []blocker
+	for i := range pending {
+		obj := &pending[i]
+		if len(obj.GetFinalizers()) > 0 {
+			blockers = append(blockers, finalizersBlocker(obj))
+		}
+		if obj.Resource == namespaceResource {
+			blockers = append(blockers, namespaceBlockers(client, obj)...)
+		}
+	}
+	blockers = append(blockers, apiServiceBlockers(client)...)
+	return append(blockers, webhookBlockers(client)...)
+}
+
+func finalizersBlocker(obj *kube.Object) blocker {
+	return blocker{ref: obj.Ref(), reason: "finalizers: " + strings.Join(obj.GetFinalizers(), ", ")}
+}
+
+func namespaceBlockers(client *client.Client, namespace *kube.Object) []blocker {
+	var blockers []blocker
+	conditions, _, _ := unstructured.NestedSlice(namespace.Object, "status", "conditions")
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]interface{})
+		if !ok || fmt.Sprint(conditionMap["status"]) != string(corev1.ConditionTrue) {
+			continue
+		}
+		blockers = append(blockers, blocker{ref: namespace.Ref(), reason: fmt.Sprintf("%v: %v", conditionMap["type"], conditionMap["message"])})
+	}
+
+	contents, err := terminatingContents(client, namespace.GetName())
+	if err != nil {
+		log.Debugf("Failed to list the contents of namespace %s: %v", namespace.GetName(), err)
+	}
+	for i := range contents {
+		blockers = append(blockers, finalizersBlocker(&contents[i]))
+	}
+	return blockers
+}
+
+// terminatingContents returns the objects in a namespace that are being deleted and wait for finalizers
+func terminatingContents(client *client.Client, namespace string) ([]kube.Object, error) {
+	return kube.ListNamespaced(client, namespace, func(obj *unstructured.Unstructured) bool {
+		return obj.GetDeletionTimestamp() != nil && len(obj.GetFinalizers()) > 0
+	})
+}
+
+func apiServiceBlockers(client *client.Client) []blocker {
+	apiServices, err := client.GetDynamicClient().Resource(apiServiceResource).List(metav1.ListOptions{})
+	if err != nil {
+		log.Debugf("Failed to list APIServices: %v", err)
+		return nil
+	}
+	var blockers []blocker
+	for _, apiService := range apiServices.Items {
+		conditions, _, _ := unstructured.NestedSlice(apiService.Object, "status", "conditions")
+		for _, condition := range conditions {
+			conditionMap, ok := condition.(map[string]interface{})
+			if !ok || conditionMap["type"] != "Available" || fmt.Sprint(conditionMap["status"]) == string(corev1.ConditionTrue) {
+				continue
+			}
+			blockers = append(blockers, blocker{ref: "APIService/" + apiService.GetName(), reason: fmt.Sprintf("unavailable: %v", conditionMap["message"])})
+		}
+	}
+	return blockers
+}
+
+func webhookBlockers(client *client.Client) []blocker {
+	var blockers []blocker
+	mutating, err := client.GetClientset().AdmissionregistrationV1beta1().MutatingWebhookConfigurations().List(metav1.ListOptions{})
+	if err != nil {
+		log.Debugf("Failed to list mutating webhooks: %v", err)
+	} else {
+		for _, configuration := range mutating.Items {
+			for _, webhook := range configuration.Webhooks {
+				if reason := failingWebhookReason(client, webhook.ClientConfig, webhook.FailurePolicy); reason != "" {
+					blockers = append(blockers, blocker{ref: "MutatingWebhookConfiguration/" + configuration.Name, reason: reason})
+					break
+				}
+			}
+		}
+	}
+
+	validating, err := client.GetClientset().AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().List(metav1.ListOptions{})
+	if err != nil {
+		log.Debugf("Failed to list validating webhooks: %v", err)
+	} else {
+		for _, configuration := range validating.Items {
+			for _, webhook := range configuration.Webhooks {
+				if reason := failingWebhookReason(client, webhook.ClientConfig, webhook.FailurePolicy); reason != "" {
+					blockers = append(blockers, blocker{ref: "ValidatingWebhookConfiguration/" + configuration.Name, reason: reason})
+					break
+				}
+			}
+		}
+	}
+	return blockers
+}
+
+// failingWebhookReason returns why a webhook that rejects requests when it cannot be called has no endpoint to call,
+// or an empty string when the webhook can be called or its failures are ignored
+func failingWebhookReason(client *client.Client, clientConfig admissionregistrationv1beta1.WebhookClientConfig, failurePolicy *admissionregistrationv1beta1.FailurePolicyType) string {
+	if clientConfig.Service == nil || failurePolicy == nil || *failurePolicy != admissionregistrationv1beta1.Fail {
+		return ""
+	}
+	service := clientConfig.Service.Namespace + "/" + clientConfig.Service.Name
+	endpoints, err := client.GetClientset().CoreV1().Endpoints(clientConfig.Service.Namespace).Get(clientConfig.Service.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Sprintf("service %s not found, matching requests are rejected", service)
+	}
+	if err != nil {
+		log.Debugf("Failed to get endpoints %s: %v", service, err)
+		return ""
+	}
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return ""
+		}
+	}
+	return fmt.Sprintf("service %s has no ready endpoints, matching requests are rejected", service)
+}
+
+// forceFinalizers clears the finalizers of the pending objects and of the terminating contents of pending namespaces.
+// A namespace whose content discovery fails because of an unavailable APIService is finalized as well, as the
+// namespace controller would never finalize it.
+func forceFinalizers(client *client.Client, pending []kube.Object) {
+	for i := range pending {
+		obj := &pending[i]
+		clearFinalizers(client, obj)
+		if obj.Resource != namespaceResource {
+			continue
+		}
+		contents, err := terminatingContents(client, obj.GetName())
+		if err != nil {
+			log.Debugf("Failed to list the contents of namespace %s: %v", obj.GetName(), err)
+		}
+		for j := range contents {
+			clearFinalizers(client, &contents[j])
+		}
+		if hasDiscoveryFailure(obj) {
+			finalizeNamespace(client, obj.GetName())
+		}
+	}
+}
+
+func clearFinalizers(client *client.Client, obj *kube.Object) {
+	if len(obj.GetFinalizers()) == 0 {
+		return
+	}
+	if err := kube.ClearFinalizers(client, obj); err != nil && !apierrors.IsNotFound(err) {
+		log.Infof("Failed to clear the finalizers of %s, error: %v", obj.Ref(), err)
+		return
+	}
+	log.Infof("Cleared the finalizers of %s", obj.Ref())
+}
+
+func hasDiscoveryFailure(namespace *kube.Object) bool {
+	conditions, _, _ := unstructured.NestedSlice(namespace.Object, "status", "conditions")
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]interface{})
+		if ok && conditionMap["type"] == string(corev1.NamespaceDeletionDiscoveryFailure) && fmt.Sprint(conditionMap["status"]) == string(corev1.ConditionTrue) {
+			return true
+		}
+	}
+	return false
+}
+
+func finalizeNamespace(client *client.Client, name string) {
+	namespace, err := client.GetClientset().CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+	if err != nil {
+		log.Infof("Failed to get namespace %s, error: %v", name, err)
+		return
+	}
+	namespace.Spec.Finalizers = nil
+	if _, err := client.GetClientset().CoreV1().Namespaces().Finalize(namespace); err != nil {
+		log.Infof("Failed to finalize namespace %s, error: %v", name, err)
+		return
+	}
+	log.Infof("Finalized namespace %s", name)
+}
+
+func printBlockers(blockers []blocker) {
+	if len(blockers) == 0 {
+		fmt.Println("\nNo finalizers, unavailable APIServices or failing webhooks found, the objects may still be terminating")
+		return
+	}
+	sort.SliceStable(blockers, func(i, j int) bool {
+		return blockers[i].ref < blockers[j].ref
+	})
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\nBLOCKING OBJECT\tREASON\n")
+	for _, blocker := range blockers {
+		fmt.Fprintf(w, "%s\t%s\n", blocker.ref, blocker.reason)
+	}
+	w.Flush()
+}
+
+func objectRefs(objects []kube.Object) []string {
+	refs := make([]string, 0, len(objects))
+	for i := range objects {
+		refs = append(refs, objects[i].Ref())
+	}
+	return refs
+}
@@ -17,192 +17,202 @@ package uninstall
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/run-ai/runai-cli/pkg/util/kubectl"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/lock"
 	"github.com/run-ai/runai-cli/pkg/client"
+	"github.com/run-ai/runai-cli/pkg/kube"
 	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type uninstallFlags struct {
-	deleteAll bool
+	deleteAll       bool
+	dryRun          bool
+	yes             bool
+	timeout         time.Duration
+	forceFinalizers bool
+	components      []string
+	backend         bool
 }
 
 func Command() *cobra.Command {
 	uninstallFlags := uninstallFlags{}
 	var command = &cobra.Command{
-		Use:   "uninstall",
-		Short: "Uninstall the Run:AI cluster",
-		Args:  cobra.ExactArgs(0),
+		Use:         "uninstall",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Short:       "Uninstall the Run:AI cluster",
+		Args:        cobra.ExactArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
-			client := client.GetClient()
-			if uninstallFlags.deleteAll {
-				log.Infof("Deleting RunaiConfig")
-				deleteRunaiConfig(client)
-			} else {
-				common.ScaleRunaiOperator(client, 0)
+			if err := validateFlags(uninstallFlags); err != nil {
+				log.Error(err)
+				os.Exit(1)
 			}
-			deleteAllResources(client, uninstallFlags)
-			deleteResourcesByKubectlCommand()
-
-			if uninstallFlags.deleteAll {
-				err := client.GetClientset().CoreV1().Namespaces().Delete("runai", &metav1.DeleteOptions{})
-				if err != nil {
-					log.Infof("Failed to delete namespace runai, error %v", err)
-					os.Exit(1)
-				}
-				log.Infof("Deleted namespace runai")
+			client := client.GetClient()
+			switch {
+			case uninstallFlags.backend:
+				runBackendUninstall(client, uninstallFlags)
+			case len(uninstallFlags.components) > 0:
+				runComponentUninstall(client, uninstallFlags)
+			default:
+				runClusterUninstall(client, uninstallFlags)
 			}
-			log.Println("Successfully uninstalled Run:AI Cluster")
 		},
 	}
 	command.Flags().BoolVarP(&uninstallFlags.deleteAll, "all", "A", false, "use flag to delete: Runai Namespace, RunaiConfig, Runai Operator")
+	command.Flags().BoolVar(&uninstallFlags.dryRun, "dry-run", false, "List the objects that would be deleted without deleting them")
+	command.Flags().BoolVarP(&uninstallFlags.yes, "yes", "y", false, "Do not ask for confirmation")
+	command.Flags().DurationVar(&uninstallFlags.timeout, "timeout", defaultTerminationTimeout, "Time to wait for the deleted objects and the runai namespace to terminate, 0 to not wait")
+	command.Flags().BoolVar(&uninstallFlags.forceFinalizers, "force-finalizers", false, "Clear the finalizers of the objects that are still terminating after the timeout")
+	command.Flags().StringSliceVar(&uninstallFlags.components, "component", nil, fmt.Sprintf("Uninstall only the given components of the cluster, any of: %s", strings.Join(componentNames(), ", ")))
+	command.Flags().BoolVar(&uninstallFlags.backend, "backend", false, "Uninstall the Run:AI backend: its HelmRelease, the helm-operator and the runai-backend namespace")
 
 	return command
 }
 
-func deleteAllResources(client *client.Client, uninstallFlags uninstallFlags) {
-	deployments, err := client.GetClientset().AppsV1().Deployments("runai").List(metav1.ListOptions{})
-	if err == nil {
-		for _, deployment := range deployments.Items {
-			if !uninstallFlags.deleteAll && deployment.Name == "runai-operator" {
-				log.Infof("Keeping RunAI Operator with 0 replicas")
-				continue
-			}
-			client.GetClientset().AppsV1().Deployments("runai").Delete(deployment.Name, &metav1.DeleteOptions{})
-			log.Debugf("deleted deployment %v", deployment.Name)
-		}
+func validateFlags(uninstallFlags uninstallFlags) error {
+	if uninstallFlags.backend && (uninstallFlags.deleteAll || len(uninstallFlags.components) > 0) {
+		return fmt.Errorf("--backend cannot be used together with --all or --component")
+	}
+	if len(uninstallFlags.components) > 0 && uninstallFlags.deleteAll {
+		return fmt.Errorf("--component cannot be used together with --all")
 	}
+	return validateComponents(uninstallFlags.components)
+}
 
-	dss, err := client.GetClientset().AppsV1().DaemonSets("runai").List(metav1.ListOptions{})
-	if err == nil {
-		for _, ds := range dss.Items {
-			client.GetClientset().AppsV1().DaemonSets("runai").Delete(ds.Name, &metav1.DeleteOptions{})
-			log.Debugf("deleted ds %v", ds.Name)
-		}
+func runClusterUninstall(client *client.Client, uninstallFlags uninstallFlags) {
+	objects := collectUninstallObjects(client, uninstallFlags)
+	if uninstallFlags.dryRun {
+		printObjectsByKind(objects, uninstallFlags)
+		return
+	}
+	if !uninstallFlags.yes && !confirmUninstall(client, objects, uninstallFlags) {
+		exitAborted()
 	}
 
-	stss, err := client.GetClientset().AppsV1().StatefulSets("runai").List(metav1.ListOptions{})
-	if err == nil {
-		for _, sts := range stss.Items {
-			client.GetClientset().AppsV1().StatefulSets("runai").Delete(sts.Name, &metav1.DeleteOptions{})
-			log.Debugf("deleted sts %v", sts.Name)
-		}
+	if uninstallFlags.deleteAll {
+		log.Infof("Deleting RunaiConfig")
+		deleteRunaiConfig(client, uninstallFlags)
+	} else {
+		common.ScaleRunaiOperator(client, 0)
 	}
+	summary := deleteObjects(client, objects)
 
-	jobs, err := client.GetClientset().BatchV1().Jobs("runai").List(metav1.ListOptions{})
-	if err == nil {
-		for _, job := range jobs.Items {
-			client.GetClientset().AppsV1().StatefulSets("runai").Delete(job.Name, &metav1.DeleteOptions{})
-			log.Debugf("deleted job %v", job.Name)
-		}
+	if uninstallFlags.deleteAll {
+		deleteNamespace(client, common.RunaiNamespace)
+		objects = append(objects, *kube.NewObject(namespaceResource, "", common.RunaiNamespace))
 	}
+	summary.print()
+	waitOrExit(client, objects, uninstallFlags)
+	log.Println("Successfully uninstalled Run:AI Cluster")
+}
 
-	err = client.GetClientset().CoreV1().PersistentVolumeClaims("runai").Delete("data-runai-db-0", &metav1.DeleteOptions{})
-	if err == nil {
-		log.Debugf("Deleted PVC: data-runai-db-0")
+func runComponentUninstall(client *client.Client, uninstallFlags uninstallFlags) {
+	objects := collectComponentObjects(client, uninstallFlags.components)
+	if uninstallFlags.dryRun {
+		printDisabledValues(uninstallFlags.components)
+		printObjectsByKind(objects, uninstallFlags)
+		return
+	}
+	if !uninstallFlags.yes && !confirmPartialUninstall(client, strings.Join(uninstallFlags.components, ", "), objects) {
+		exitAborted()
 	}
 
-	err = client.GetClientset().CoreV1().PersistentVolumeClaims("runai").Delete("prometheus-runai-prometheus-operator-prometheus-db-prometheus-runai-prometheus-operator-prometheus-0", &metav1.DeleteOptions{})
-	if err == nil {
-		log.Debugf("Deleted PVC: prometheus-runai-prometheus-operator-prometheus-db-prometheus-runai-prometheus-operator-prometheus-0")
+	if err := disableComponents(client, uninstallFlags.components); err != nil {
+		log.Error(err)
+		os.Exit(1)
 	}
+	summary := deleteObjects(client, objects)
+	summary.print()
+	waitOrExit(client, objects, uninstallFlags)
+	log.Infof("Successfully uninstalled %s", strings.Join(uninstallFlags.components, ", "))
+}
 
-	err = client.GetClientset().CoreV1().PersistentVolumeClaims("runai").Delete("storage-volume-runai-prometheus-pushgateway-0", &metav1.DeleteOptions{})
-	if err == nil {
-		log.Debugf("Deleted PVC: storage-volume-runai-prometheus-pushgateway-0")
+func runBackendUninstall(client *client.Client, uninstallFlags uninstallFlags) {
+	helmReleases, helmOperator := collectBackendObjects(client)
+	objects := append(append([]kube.Object{}, helmReleases...), helmOperator...)
+	if uninstallFlags.dryRun {
+		printObjectsByKind(objects, uninstallFlags)
+		return
+	}
+	if !uninstallFlags.yes && !confirmPartialUninstall(client, "the Run:AI backend and namespace "+common.RunaiBackendNamespace, objects) {
+		exitAborted()
 	}
+
+	summary, err := uninstallBackend(client, helmReleases, helmOperator, uninstallFlags)
+	summary.print()
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	waitOrExit(client, append(objects, *kube.NewObject(namespaceResource, "", common.RunaiBackendNamespace)), uninstallFlags)
+	log.Println("Successfully uninstalled Run:AI Backend")
 }
 
-func deleteRunaiConfig(client *client.Client) {
-	runaiconfigResource := schema.GroupVersionResource{Group: "run.ai", Version: "v1", Resource: "runaiconfigs"}
-	var error error
-	var runaiConfig *unstructured.Unstructured
+func waitOrExit(client *client.Client, objects []kube.Object, uninstallFlags uninstallFlags) {
+	if uninstallFlags.timeout == 0 {
+		return
+	}
+	if err := waitForTermination(client, objects, uninstallFlags); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+}
+
+func deleteNamespace(client *client.Client, name string) {
+	namespace, err := client.GetClientset().CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		log.Infof("Namespace %s not found", name)
+		return
+	}
+	if err == nil && namespace.DeletionTimestamp != nil {
+		log.Infof("Namespace %s is already terminating", name)
+		return
+	}
+	err = client.GetClientset().CoreV1().Namespaces().Delete(name, &metav1.DeleteOptions{})
+	if err != nil {
+		log.Infof("Failed to delete namespace %s, error %v", name, err)
+		os.Exit(1)
+	}
+	log.Infof("Deleted namespace %s", name)
+}
+
+// deleteRunaiConfig deletes the RunaiConfig before the operator, which removes its finalizer, is deleted. The
+// termination is waited for like the other objects; with --timeout 0 nothing waits for the operator, so the finalizers
+// are cleared instead.
+func deleteRunaiConfig(client *client.Client, uninstallFlags uninstallFlags) {
+	runaiConfig, err := kube.GetObject(client, kube.NewObject(common.RunaiConfigResource, common.RunaiNamespace, common.RunaiConfigName))
+	if err != nil {
+		fmt.Println("Failed to get RunaiConfig")
+		return
+	}
 	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
-		runaiConfig, error = client.GetDynamicClient().Resource(runaiconfigResource).Namespace("runai").Get("runai", metav1.GetOptions{})
-		if error != nil {
-			fmt.Println("Failed to get RunaiConfig")
-			return
+		if uninstallFlags.timeout == 0 {
+			err = kube.ClearFinalizers(client, runaiConfig)
+			if err != nil {
+				log.Debugf("Failed to clear runaiconfig finalizers, attempt: %v, error: %v", i, err)
+				continue
+			}
 		}
-		var emptyMap []string
-		err := unstructured.SetNestedStringSlice(runaiConfig.Object, emptyMap, "metadata", "finalizers")
+		err = kube.DeleteObject(client, runaiConfig)
 		if err != nil {
-			fmt.Printf("Failed to update RunaiConfig finalizer, error: %v", err)
-			os.Exit(1)
-		}
-		_, error = client.GetDynamicClient().Resource(runaiconfigResource).Namespace("runai").Update(runaiConfig, metav1.UpdateOptions{})
-		if error != nil {
-			log.Debugf("Failed to update runaiconfig, attempt: %v, error: %v", i, error)
-			continue
-		}
-		error = client.GetDynamicClient().Resource(runaiconfigResource).Namespace("runai").Delete("runai", &metav1.DeleteOptions{})
-		if error != nil {
-			log.Debugf("Failed to delete runaiconfig, attempt: %v, error: %v", i, error)
+			log.Debugf("Failed to delete runaiconfig, attempt: %v, error: %v", i, err)
 			continue
 		}
 
 		break
 	}
 
-	if error != nil {
-		log.Infof("Failed to update runaiconfig, error: %v", error)
+	if err != nil {
+		log.Infof("Failed to delete runaiconfig, error: %v", err)
 		os.Exit(1)
 	}
 
 	log.Infof("Deleted runaiconfig")
-}
-
-func deleteResourcesByKubectlCommand() {
-	pspToDelete := []string{"psp", "runai-admission-controller", "runai-grafana", "runai-grafana-test", "runai-init-ca", "runai-kube-state-metrics", "runai-local-path-provisioner", "runai-prometheus-node-exporter", "runai-prometheus-operator-operator", "runai-prometheus-operator-prometheus", "runai-prometheus-pushgateway", "runai-nginx-ingress", "runai-nginx-ingress-backend", "mpi-operator", "runai-job-controller", "runai-prometheus-operator-admission", "runai-project-controller", "runai-kube-prometheus-stac-prometheus", "nfd-master", "runai-job-viewer", "runai-job-executor"}
-	kubectl.Delete(pspToDelete)
-
-	clusterRoleToDelete := []string{"clusterrole", "init-ca", "psp-runai-kube-state-metrics", "psp-runai-prometheus-node-exporter", "runai", "runai-admission-controller", "runai-grafana-clusterrole", "runai-kube-state-metrics", "runai-prometheus-operator-operator", "runai-prometheus-operator-operator-psp", "runai-prometheus-operator-prometheus", "runai-prometheus-operator-prometheus-psp", "runai-local-path-provisioner", "mpi-operator", "runai-nginx-ingress", "runai-job-controller", "runai-nfs-client-provisioner-runner", "runai-project-controller", "runai-kube-prometheus-stac-operator", "runai-kube-prometheus-stac-operator-psp", "runai-kube-prometheus-stac-prometheus", "runai-kube-prometheus-stac-prometheus-psp", "nfd-master", "runai-job-viewer", "runai-job-executor", "runai-cli-index-map-editor", "runai-scheduler-rw", "runai-scheduler-ro", "runai-project-controller-project", "runai-project-controller-administrator", "runai-operator", "runai-nvidia-device-plugin", "runai-job-controller-project", "runai-agent", "researcher-service", "runai-fluentd", "runai-project-controller-cluster-secret", "runai-scheduler-ro", "runai-scheduler-rw", "runai-cli-index-map-editor", "runai-job-controller-project", "runai-job-executor", "runai-project-controller-cluster-secret-per-project", "runai-project-controller-project", "researcher-service", "runai-admission-controller-ro", "runai-admission-controller-project", "researcher-service-ro"}
-	kubectl.Delete(clusterRoleToDelete)
-
-	clusterRoleBindingToDelete := []string{"clusterrolebinding", "default-sa-admin", "init-ca", "psp-runai-kube-state-metrics", "psp-runai-prometheus-node-exporter", "runai", "runai-admission-controller", "runai-grafana-clusterrolebinding", "runai-kube-state-metrics", "runai-prometheus-operator-operator", "runai-prometheus-operator-operator-psp", "runai-prometheus-operator-prometheus", "runai-prometheus-operator-prometheus-psp", "runai-local-path-provisioner", "mpi-operator", "runai-nginx-ingress", "runai-job-controller", "run-runai-nfs-client-provisioner", "runai-project-controller", "runai-kube-prometheus-stac-operator", "runai-kube-prometheus-stac-operator-psp", "runai-kube-prometheus-stac-prometheus", "runai-kube-prometheus-stac-prometheus-psp", "nfd-master", "runai-job-viewer", "runai-job-executor", "researcher-service", "runai-agent", "runai-nvidia-device-plugin", "runai-operator", "runai-project-controller-administrator", "runai-scheduler-ro", "runai-scheduler-rw", "runai-fluentd", "nfd-master", "mpi-operator", "runai-admission-controller", "runai-agent", "runai-job-controller", "runai-job-viewer", "runai-job-viewer-manual", "runai-nvidia-device-plugin", "runai-operator", "runai-project-controller", "runai-project-controller-administrator", "runai-project-controller-cluster-secret", "runai-scheduler-ro", "runai-scheduler-rw", "researcher-service", "runai-admission-controller-ro", "researcher-service-ro"}
-	kubectl.Delete(clusterRoleBindingToDelete)
-
-	mutatingWebhookConfigurationToDelete := []string{"MutatingWebhookConfiguration", "runai-fractional-gpus", "runai-label-project", "runai-mutating-webhook", "runai-prometheus-operator-admission", "runai-reporter-library", "runai-node-affinity", "runai-resource-gpu-factor", "runai-kube-prometheus-stac-admission"}
-	kubectl.Delete(mutatingWebhookConfigurationToDelete)
-
-	validatingWebhookConfiguration := []string{"ValidatingWebhookConfiguration", "runai-prometheus-operator-admission", "runai-validate-elastic", "runai-validate-fractional", "runai-kube-prometheus-stac-admission"}
-	kubectl.Delete(validatingWebhookConfiguration)
-
-	pcToDelete := []string{"pc", "build", "interactive-preemptible", "train", "runai-critical"}
-	kubectl.Delete(pcToDelete)
-
-        crdToDelete := []string{"crd", "prometheuses.monitoring.coreos.com", "projects.run.ai", "podgroups.scheduling.incubator.k8s.io", "queues.scheduling.incubator.k8s.io", "runaijobs.run.ai", "departments.scheduling.incubator.k8s.io"}
-	kubectl.Delete(crdToDelete)
-
-	scToDelete := []string{"sc", "local-path", "nfs-client"}
-	kubectl.Delete(scToDelete)
-
-	departmentToDelete := []string{"department", "default"}
-	kubectl.Delete(departmentToDelete)
-
-	services := []string{"service", "-n", "kube-system", "runai-prometheus-operator-coredns", "runai-prometheus-operator-kube-controller-manager", "runai-prometheus-operator-kube-etcd", "runai-prometheus-operator-kube-proxy", "runai-prometheus-operator-kube-scheduler", "runai-prometheus-operator-kubelet", "kube-prometheus-stack-kubelet", "prom-kube-prometheus-stack-kubelet", "runai-kube-prometheus-stac-kubelet"}
-	kubectl.Delete(services)
-
-	roles := []string{"roles", "-n", "runai", "--all"}
-	kubectl.Delete(roles)
-
-	svc := []string{"services", "-n", "runai", "--all"}
-	kubectl.Delete(svc)
-
-	mutatingwebhookconfigurations := []string{"mutatingwebhookconfigurations.admissionregistration.k8s.io", "-n", "runai", "--all"}
-	kubectl.Delete(mutatingwebhookconfigurations)
-
-	serviceaccounts := []string{"serviceaccount", "-n", "runai", "--all"}
-	kubectl.Delete(serviceaccounts)
-
-	servicemonitor := []string{"servicemonitor", "-n", "runai", "--all"}
-	kubectl.Delete(servicemonitor)
-
-	rolebindings := []string{"rolebinding", "-n", "runai", "--all"}
-	kubectl.Delete(rolebindings)
+	waitOrExit(client, []kube.Object{*runaiConfig}, uninstallFlags)
 }
@@ -0,0 +1,58 @@
+package upgrade
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/run-ai/runai-cli/autogenerate"
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	"github.com/run-ai/runai-cli/pkg/kube"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// printUpgradePlan prints everything the upgrade would change without changing anything
+func printUpgradePlan(client *client.Client, upgradeFlags upgradeFlags, plan *upgradePlan) error {
+	if upgradeFlags.filePath != "" {
+		objects, err := kube.ReadManifestFile(upgradeFlags.filePath)
+		if err != nil {
+			return err
+		}
+		kube.PrintDiffs(os.Stdout, fmt.Sprintf("Configuration file %s", upgradeFlags.filePath), kube.Diff(client, objects))
+	}
+
+	objects, err := kube.ParseManifests([]byte(autogenerate.PreInstallYaml))
+	if err != nil {
+		return err
+	}
+	kube.PrintDiffs(os.Stdout, "Pre-upgrade yamls", kube.Diff(client, objects))
+
+	if plan == nil {
+		return nil
+	}
+
+	fmt.Println("=== Operator image")
+	if plan.newImage == plan.currentImage {
+		fmt.Printf("unchanged %s\n\n", plan.currentImage)
+	} else {
+		fmt.Printf("    ~ %s -> %s\n\n", plan.currentImage, plan.newImage)
+	}
+
+	fmt.Println("=== StatefulSets and PVCs to delete")
+	if !plan.hasMigration(migrationRecreateStatefulSets) {
+		fmt.Printf("none\n\n")
+		return nil
+	}
+	for _, statefulSet := range statefulSetsToDelete {
+		if _, err := client.GetClientset().AppsV1().StatefulSets(common.RunaiNamespace).Get(statefulSet, metav1.GetOptions{}); err == nil {
+			fmt.Printf("delete StatefulSet/%s/%s\n", common.RunaiNamespace, statefulSet)
+		}
+	}
+	for _, pvc := range pvcsToDelete {
+		if _, err := client.GetClientset().CoreV1().PersistentVolumeClaims(common.RunaiNamespace).Get(pvc, metav1.GetOptions{}); err == nil {
+			fmt.Printf("delete PersistentVolumeClaim/%s/%s\n", common.RunaiNamespace, pvc)
+		}
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,160 @@
+package upgrade
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/pkg/client"
+	cliVersion "github.com/run-ai/runai-cli/pkg/version"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	historyConfigMapName = "runai-adm-history"
+	revisionKeyPrefix    = "revision-"
+	maxRevisions         = 10
+)
+
+// revision is the state of the cluster before an upgrade, as needed to roll it back
+type revision struct {
+	Revision        int                    `json:"revision"`
+	Timestamp       time.Time              `json:"timestamp"`
+	Command         string                 `json:"command"`
+	CliVersion      string                 `json:"cliVersion"`
+	OperatorImage   string                 `json:"operatorImage"`
+	ConfigFileHash  string                 `json:"configFileHash,omitempty"`
+	RunaiConfigSpec map[string]interface{} `json:"runaiConfigSpec,omitempty"`
+}
+
+// recordRevision saves the current operator image and RunaiConfig spec to the history ConfigMap
+func recordRevision(client *client.Client, command, configFilePath string) error {
+	operatorImage, err := getOperatorImage(client)
+	if err != nil {
+		return err
+	}
+
+	newRevision := revision{
+		Timestamp:     time.Now().UTC(),
+		Command:       command,
+		OperatorImage: operatorImage,
+	}
+	if version, err := cliVersion.GetVersion(); err == nil {
+		newRevision.CliVersion = version.Version
+	}
+	if configFilePath != "" {
+		data, err := ioutil.ReadFile(configFilePath)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(data)
+		newRevision.ConfigFileHash = hex.EncodeToString(hash[:])
+	}
+	runaiConfig, err := client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Get(common.RunaiConfigName, metav1.GetOptions{})
+	if err == nil {
+		newRevision.RunaiConfigSpec, _, _ = unstructured.NestedMap(runaiConfig.Object, "spec")
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		err = saveRevision(client, newRevision)
+		if err == nil {
+			break
+		}
+		log.Debugf("Failed to save revision, attempt: %v, error: %v", i, err)
+	}
+	return err
+}
+
+func saveRevision(client *client.Client, newRevision revision) error {
+	configMaps := client.GetClientset().CoreV1().ConfigMaps(common.RunaiNamespace)
+	configMap, err := configMaps.Get(historyConfigMapName, metav1.GetOptions{})
+	create := apierrors.IsNotFound(err)
+	if err != nil && !create {
+		return err
+	}
+	if create {
+		configMap = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: historyConfigMapName, Namespace: common.RunaiNamespace}}
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+
+	revisions, err := parseRevisions(configMap)
+	if err != nil {
+		return err
+	}
+	newRevision.Revision = 1
+	if len(revisions) > 0 {
+		newRevision.Revision = revisions[len(revisions)-1].Revision + 1
+	}
+	data, err := json.Marshal(newRevision)
+	if err != nil {
+		return err
+	}
+	configMap.Data[revisionKey(newRevision.Revision)] = string(data)
+	for _, old := range revisions {
+		if newRevision.Revision-old.Revision >= maxRevisions {
+			delete(configMap.Data, revisionKey(old.Revision))
+		}
+	}
+
+	if create {
+		_, err = configMaps.Create(configMap)
+	} else {
+		_, err = configMaps.Update(configMap)
+	}
+	if err == nil {
+		log.Debugf("Recorded revision %d, operator image: %s", newRevision.Revision, newRevision.OperatorImage)
+	}
+	return err
+}
+
+// getRevisions returns the recorded revisions, oldest first
+func getRevisions(client *client.Client) ([]revision, error) {
+	configMap, err := client.GetClientset().CoreV1().ConfigMaps(common.RunaiNamespace).Get(historyConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRevisions(configMap)
+}
+
+func parseRevisions(configMap *v1.ConfigMap) ([]revision, error) {
+	var revisions []revision
+	for key, value := range configMap.Data {
+		if !strings.HasPrefix(key, revisionKeyPrefix) {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimPrefix(key, revisionKeyPrefix)); err != nil {
+			continue
+		}
+		var parsed revision
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			return nil, fmt.Errorf("failed to parse %s in ConfigMap %s: %v", key, historyConfigMapName, err)
+		}
+		revisions = append(revisions, parsed)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+	return revisions, nil
+}
+
+func revisionKey(revision int) string {
+	return fmt.Sprintf("%s%d", revisionKeyPrefix, revision)
+}
@@ -0,0 +1,118 @@
+package upgrade
+
+import (
+	"fmt"
+
+	"github.com/run-ai/runai-cli/pkg/image"
+	"github.com/run-ai/runai-cli/pkg/semver"
+	log "github.com/sirupsen/logrus"
+)
+
+type migration string
+
+const (
+	// migrationRecreateStatefulSets deletes the database and metrics statefulsets and their PVCs so the operator recreates them
+	migrationRecreateStatefulSets migration = "recreate-statefulsets"
+)
+
+// upgradePath describes an upgrade from a version in [fromMin, fromMax) to a version >= toMin that needs data migrations
+type upgradePath struct {
+	fromMin     semver.Version
+	fromMax     semver.Version
+	toMin       semver.Version
+	migrations  []migration
+	description string
+}
+
+var upgradePaths = []upgradePath{
+	{
+		fromMin:     semver.MustParse("0.0.0"),
+		fromMax:     semver.MustParse("1.0.93"),
+		toMin:       semver.MustParse("1.0.93"),
+		migrations:  []migration{migrationRecreateStatefulSets},
+		description: "the storage of runai-db, the pushgateway and prometheus changed in 1.0.93",
+	},
+}
+
+type upgradePlan struct {
+	currentImage string
+	newImage     string
+	migrations   []migration
+}
+
+func (p upgradePlan) hasMigration(m migration) bool {
+	for _, planned := range p.migrations {
+		if planned == m {
+			return true
+		}
+	}
+	return false
+}
+
+// planUpgrade computes the operator image to set and the data migrations needed to get there.
+// Downgrades, skipped major versions and versions that cannot be parsed are rejected unless forced.
+func planUpgrade(currentImageName string, upgradeFlags upgradeFlags) (upgradePlan, error) {
+	plan := upgradePlan{currentImage: currentImageName, newImage: currentImageName}
+	current, err := image.ParseReference(currentImageName)
+	if err != nil {
+		return plan, err
+	}
+
+	if current.Tag == "latest" {
+		if upgradeFlags.operatorVersion != "latest" {
+			log.Infof("Setting image to 'latest' as an old image was 'latest'")
+		}
+		return plan, nil
+	}
+
+	target := current.WithTag(upgradeFlags.operatorVersion)
+	if upgradeFlags.image != "" {
+		target, err = image.ParseReference(upgradeFlags.image)
+		if err != nil {
+			return plan, err
+		}
+	}
+	plan.newImage = target.String()
+
+	currentVersion, currentErr := semver.Parse(current.Tag)
+	targetVersion, targetErr := semver.Parse(target.Tag)
+	if currentErr != nil || targetErr != nil {
+		if !upgradeFlags.force {
+			return plan, fmt.Errorf("cannot validate the upgrade from %q to %q as the versions are not semantic versions, use --force to upgrade anyway", current.Tag, target.Tag)
+		}
+		log.Warnf("Upgrading from %q to %q without validation, no data migrations will run", current.Tag, target.Tag)
+		return plan, nil
+	}
+
+	if err := validateUpgradePath(currentVersion, targetVersion); err != nil {
+		if !upgradeFlags.force {
+			return plan, fmt.Errorf("%v, use --force to upgrade anyway", err)
+		}
+		log.Warnf("Forcing upgrade: %v", err)
+	}
+
+	plan.migrations = migrationsForUpgrade(currentVersion, targetVersion)
+	return plan, nil
+}
+
+func validateUpgradePath(current, target semver.Version) error {
+	if target.LessThan(current) {
+		return fmt.Errorf("downgrade from %v to %v is not supported", current, target)
+	}
+	if target.Major > current.Major+1 {
+		return fmt.Errorf("upgrade from %v to %v skips a major version, upgrade to %d.x first", current, target, current.Major+1)
+	}
+	return nil
+}
+
+func migrationsForUpgrade(current, target semver.Version) []migration {
+	var migrations []migration
+	for _, path := range upgradePaths {
+		if current.LessThan(path.fromMin) || !current.LessThan(path.fromMax) || target.LessThan(path.toMin) {
+			continue
+		}
+		log.Infof("Upgrade from %v to %v requires data migration: %s", current, target, path.description)
+		migrations = append(migrations, path.migrations...)
+	}
+	return migrations
+}
@@ -0,0 +1,154 @@
+package upgrade
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/cmd/lock"
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type rollbackFlags struct {
+	list       bool
+	toRevision int
+}
+
+func Rollback() *cobra.Command {
+	rollbackFlags := rollbackFlags{}
+	var command = &cobra.Command{
+		Use:         "rollback",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Short:       "Roll back the Run:AI cluster to the operator version and configuration before the last upgrade",
+		Args:        cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := client.GetClient()
+			revisions, err := getRevisions(client)
+			if err != nil {
+				log.Errorf("Failed to get the upgrade history, error: %v", err)
+				os.Exit(1)
+			}
+			if len(revisions) == 0 {
+				log.Error("No upgrade history was found")
+				os.Exit(1)
+			}
+
+			if rollbackFlags.list {
+				printRevisions(revisions)
+				return
+			}
+
+			j, err := journal.Begin(client, "rollback")
+			if err != nil {
+				log.Error(err)
+				os.Exit(1)
+			}
+			// the record-revision step adds a revision, so a resumed run must not choose the last one again
+			targetRevision, err := j.Value("targetRevision", func() (string, error) {
+				if rollbackFlags.toRevision != 0 {
+					return strconv.Itoa(rollbackFlags.toRevision), nil
+				}
+				return strconv.Itoa(revisions[len(revisions)-1].Revision), nil
+			})
+			if err != nil {
+				log.Error(err)
+				finishUnlessResuming(j)
+				os.Exit(1)
+			}
+			target, found := findRevision(revisions, targetRevision)
+			if !found {
+				log.Errorf("Revision %s was not found in the upgrade history", targetRevision)
+				finishUnlessResuming(j)
+				os.Exit(1)
+			}
+
+			j.Step("record-revision", func() {
+				if err := recordRevision(client, "rollback", ""); err != nil {
+					log.Errorf("Failed to record the upgrade history, error: %v", err)
+					os.Exit(1)
+				}
+			})
+
+			log.Infof("Rolling back to revision %d, operator image: %s", target.Revision, target.OperatorImage)
+			withOperatorScaledDown(client, j, func() {
+				j.Step("set-operator-image", func() {
+					setOperatorImage(client, target.OperatorImage, j)
+				})
+				j.Step("restore-runaiconfig", func() {
+					recordRunaiConfigSpec(client, j)
+					restoreRunaiConfigSpec(client, target.RunaiConfigSpec)
+				})
+			})
+			j.Finish()
+
+			log.Println("Successfully rolled back the Run:AI Cluster")
+		},
+	}
+
+	command.Flags().BoolVar(&rollbackFlags.list, "list", false, "List the upgrade history")
+	command.Flags().IntVar(&rollbackFlags.toRevision, "to-revision", 0, "Revision to roll back to (default: the last one)")
+
+	return command
+}
+
+func findRevision(revisions []revision, number string) (revision, bool) {
+	for _, revision := range revisions {
+		if strconv.Itoa(revision.Revision) == number {
+			return revision, true
+		}
+	}
+	return revision{}, false
+}
+
+func printRevisions(revisions []revision) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "REVISION\tTIMESTAMP\tCOMMAND\tCLI VERSION\tOPERATOR IMAGE\tCONFIG FILE HASH\n")
+	for _, revision := range revisions {
+		hash := revision.ConfigFileHash
+		if len(hash) > 12 {
+			hash = hash[:12]
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", revision.Revision, revision.Timestamp.Format("2006-01-02 15:04:05"), revision.Command, revision.CliVersion, revision.OperatorImage, hash)
+	}
+	w.Flush()
+}
+
+func restoreRunaiConfigSpec(client *client.Client, spec map[string]interface{}) {
+	if spec == nil {
+		log.Infof("No RunaiConfig spec was recorded, keeping the current one")
+		return
+	}
+
+	var err error
+	var runaiConfig *unstructured.Unstructured
+	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
+		runaiConfig, err = client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Get(common.RunaiConfigName, metav1.GetOptions{})
+		if err != nil {
+			log.Infof("Failed to get RunaiConfig, error: %v", err)
+			os.Exit(1)
+		}
+		err = unstructured.SetNestedMap(runaiConfig.Object, spec, "spec")
+		if err != nil {
+			log.Infof("Failed to set RunaiConfig spec, error: %v", err)
+			os.Exit(1)
+		}
+		_, err = client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Update(runaiConfig, metav1.UpdateOptions{})
+		if err != nil {
+			log.Debugf("Failed to update runaiconfig, attempt: %v, error: %v", i, err)
+			continue
+		}
+		break
+	}
+	if err != nil {
+		log.Infof("Failed to update runaiconfig, error: %v", err)
+		os.Exit(1)
+	}
+	log.Debugf("Restored RunaiConfig spec")
+}
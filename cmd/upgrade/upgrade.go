@@ -16,15 +16,17 @@ package upgrade
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
-	"strconv"
-	"strings"
+	"time"
 
 	"github.com/run-ai/runai-cli/autogenerate"
+	"github.com/run-ai/runai-cli/cmd/backup"
 	"github.com/run-ai/runai-cli/cmd/common"
+	"github.com/run-ai/runai-cli/cmd/health"
+	"github.com/run-ai/runai-cli/cmd/journal"
+	"github.com/run-ai/runai-cli/cmd/lock"
 	"github.com/run-ai/runai-cli/pkg/client"
-	"github.com/run-ai/runai-cli/pkg/util/kubectl"
+	"github.com/run-ai/runai-cli/pkg/kube"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	appsv1 "k8s.io/api/apps/v1"
@@ -35,14 +37,22 @@ type upgradeFlags struct {
 	filePath        string
 	operatorVersion string
 	image           string
+	wait            bool
+	timeout         time.Duration
+	dryRun          bool
+	force           bool
+	backupDir       string
+	skipBackup      bool
+	backupDatabase  bool
 }
 
 func Command() *cobra.Command {
 	upgradeFlags := upgradeFlags{}
 	var command = &cobra.Command{
-		Use:   "upgrade",
-		Short: "Upgrade Run:AI cluster",
-		Args:  cobra.ExactArgs(0),
+		Use:         "upgrade",
+		Annotations: map[string]string{lock.Annotation: "true"},
+		Short:       "Upgrade Run:AI cluster",
+		Args:        cobra.ExactArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
 			if cmd.Flags().NFlag() == 0 {
 				fmt.Println("No flags were provided")
@@ -50,31 +60,92 @@ func Command() *cobra.Command {
 				return
 			}
 
-			if upgradeFlags.filePath != "" {
-				log.Infof("Installing from file: %v", upgradeFlags.filePath)
-				for i := 0; i < 2; i++ {
-					kubectl.Apply(upgradeFlags.filePath) // need to remove the crds from this file
+			client := client.GetClient()
+			var j *journal.Journal
+			if !upgradeFlags.dryRun {
+				var err error
+				j, err = journal.Begin(client, "upgrade")
+				if err != nil {
+					log.Error(err)
+					os.Exit(1)
 				}
 			}
 
-			upgradeYamlsBeforeRun()
-
+			var plan *upgradePlan
 			if upgradeFlags.operatorVersion != "" || upgradeFlags.image != "" {
-				client := client.GetClient()
-				common.ScaleRunaiOperator(client, 0)
-				josList, err := client.GetClientset().BatchV1().Jobs("runai").List(metav1.ListOptions{})
+				// a resumed upgrade plans from the image before the interrupted run changed it
+				currentImage, err := j.Value("operatorImage", func() (string, error) {
+					return getOperatorImage(client)
+				})
 				if err != nil {
-					fmt.Printf("Failed to list jobs in the runai namespace, error: %v", err)
+					log.Error(err)
+					finishUnlessResuming(j)
 					os.Exit(1)
 				}
-				for _, job := range josList.Items {
-					client.GetClientset().BatchV1().Jobs("runai").Delete(job.Name, &metav1.DeleteOptions{})
-					log.Debugf("Deleted Job: %v", job.Name)
+				newPlan, err := planUpgrade(currentImage, upgradeFlags)
+				if err != nil {
+					log.Errorf("Failed to upgrade the Run:AI cluster, error: %v", err)
+					finishUnlessResuming(j)
+					os.Exit(1)
 				}
+				plan = &newPlan
+			}
 
-				upgradeVersion(client, upgradeFlags)
+			if upgradeFlags.dryRun {
+				if err := printUpgradePlan(client, upgradeFlags, plan); err != nil {
+					log.Error(err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			if plan != nil && plan.hasMigration(migrationRecreateStatefulSets) && !upgradeFlags.skipBackup {
+				j.Step("backup", func() {
+					archivePath, err := backup.Create(client, upgradeFlags.backupDir, upgradeFlags.backupDatabase)
+					if err != nil {
+						log.Errorf("Failed to back up the Run:AI state before deleting the statefulsets, use --skip-backup to upgrade anyway, error: %v", err)
+						finishUnlessResuming(j)
+						os.Exit(1)
+					}
+					restoreCommand := fmt.Sprintf("runai-adm restore -f %s", archivePath)
+					if upgradeFlags.backupDatabase {
+						restoreCommand += " --with-db"
+					}
+					log.Infof("Run '%s' after the upgrade to restore the Run:AI state", restoreCommand)
+				})
+			}
 
-				common.ScaleRunaiOperator(client, 1)
+			j.Step("record-revision", func() {
+				if err := recordRevision(client, "upgrade", upgradeFlags.filePath); err != nil {
+					log.Errorf("Failed to record the upgrade history, error: %v", err)
+					os.Exit(1)
+				}
+			})
+
+			if upgradeFlags.filePath != "" {
+				j.Step("apply-config", func() {
+					recordRunaiConfigSpec(client, j)
+					log.Infof("Installing from file: %v", upgradeFlags.filePath)
+					if err := kube.ApplyFile(client, upgradeFlags.filePath); err != nil {
+						log.Errorf("Failed to apply %v, error: %v", upgradeFlags.filePath, err)
+						os.Exit(1)
+					}
+				})
+			}
+
+			j.Step("pre-upgrade-yamls", func() {
+				upgradeYamlsBeforeRun(client)
+			})
+
+			if plan != nil {
+				withOperatorScaledDown(client, j, func() {
+					upgradeVersion(client, *plan, j)
+				})
+			}
+			j.Finish()
+
+			if upgradeFlags.wait {
+				health.ExitIfNotReady(client, upgradeFlags.timeout)
 			}
 
 			log.Println("Successfully upgraded the Run:AI Cluster")
@@ -85,52 +156,112 @@ func Command() *cobra.Command {
 	command.Flags().StringVarP(&upgradeFlags.operatorVersion, "version", "v", "", "Set a Run:AI version (e.g. 1.0.45)")
 	command.Flags().StringVarP(&upgradeFlags.image, "image", "i", "", "set image")
 	command.Flags().MarkHidden("image")
+	command.Flags().BoolVar(&upgradeFlags.wait, "wait", false, "Wait until all Run:AI components are ready")
+	command.Flags().DurationVar(&upgradeFlags.timeout, "timeout", health.DefaultTimeout, "Time to wait for the Run:AI components when using --wait")
+	command.Flags().BoolVar(&upgradeFlags.force, "force", false, "Allow downgrades, skipped major versions and versions that cannot be validated")
+	command.Flags().StringVar(&upgradeFlags.backupDir, "backup-dir", ".", "Directory for the backup archive created before destructive upgrades. The archive contains the Run:AI secrets and is readable only by the user")
+	command.Flags().BoolVar(&upgradeFlags.skipBackup, "skip-backup", false, "Do not back up the Run:AI state before destructive upgrades")
+	command.Flags().BoolVar(&upgradeFlags.backupDatabase, "backup-db", true, "Include a dump of runai-db in the backup archive")
+	command.Flags().BoolVar(&upgradeFlags.dryRun, "dry-run", false, "Print the changes the upgrade would make without applying them")
 
 	return command
 }
 
-func upgradeYamlsBeforeRun() {
+// withOperatorScaledDown runs update while the operator is scaled down and its jobs are cleaned up,
+// then scales the operator back to the replicas it had
+func withOperatorScaledDown(client *client.Client, j *journal.Journal, update func()) {
+	j.Step("scale-down-operator", func() {
+		j.ScaleDown(client, common.RunaiNamespace, common.RunaiOperatorDeploymentName)
+		josList, err := client.GetClientset().BatchV1().Jobs("runai").List(metav1.ListOptions{})
+		if err != nil {
+			fmt.Printf("Failed to list jobs in the runai namespace, error: %v", err)
+			journal.Exit()
+		}
+		for _, job := range josList.Items {
+			client.GetClientset().BatchV1().Jobs("runai").Delete(job.Name, &metav1.DeleteOptions{})
+			log.Debugf("Deleted Job: %v", job.Name)
+		}
+	})
+
+	update()
+
+	j.Step("restore-operator", func() {
+		j.RestoreReplicas(client, common.RunaiNamespace, common.RunaiOperatorDeploymentName)
+	})
+}
+
+// finishUnlessResuming drops the journal of a run that failed before changing anything
+func finishUnlessResuming(j *journal.Journal) {
+	if !journal.IsResuming() {
+		j.Finish()
+	}
+}
+
+// recordRunaiConfigSpec records the RunaiConfig spec in the journal, if Run:AI is installed
+func recordRunaiConfigSpec(client *client.Client, j *journal.Journal) {
+	runaiConfig, err := client.GetDynamicClient().Resource(common.RunaiConfigResource).Namespace(common.RunaiNamespace).Get(common.RunaiConfigName, metav1.GetOptions{})
+	if err == nil {
+		j.RecordObjectSpec(common.RunaiConfigResource, runaiConfig)
+	}
+}
+
+func upgradeYamlsBeforeRun(client *client.Client) {
 	log.Infof("Upgrading yamls before upgrade")
-	file, err := ioutil.TempFile("", "pre_upgrade.yaml")
+	if err := kube.ApplyYaml(client, autogenerate.PreInstallYaml); err != nil {
+		log.Errorf("Failed to upgrade yamls, error: %v", err)
+		os.Exit(1)
+	}
+}
+
+var (
+	statefulSetsToDelete = []string{"runai-db", "runai-prometheus-pushgateway", "prometheus-runai-prometheus-operator-prometheus"}
+	pvcsToDelete         = []string{"data-runai-db-0", "prometheus-runai-prometheus-operator-prometheus-db-prometheus-runai-prometheus-operator-prometheus-0", "storage-volume-runai-prometheus-pushgateway-0"}
+)
+
+func getOperatorImage(client *client.Client) (string, error) {
+	deployment, err := client.GetClientset().AppsV1().Deployments(common.RunaiNamespace).Get(common.RunaiOperatorDeploymentName, metav1.GetOptions{})
 	if err != nil {
-		fmt.Println(err)
+		return "", fmt.Errorf("Run:AI operator does not exist on runai namespace, error: %v", err)
 	}
-	defer os.Remove(file.Name())
-	if _, err := file.Write([]byte(autogenerate.PreInstallYaml)); err != nil {
-		fmt.Errorf("failed to write file error: %v", err)
-		os.Exit(1)
+	return deployment.Spec.Template.Spec.Containers[0].Image, nil
+}
+
+func upgradeVersion(client *client.Client, plan upgradePlan, j *journal.Journal) {
+	j.Step("set-operator-image", func() {
+		setOperatorImage(client, plan.newImage, j)
+	})
+
+	if !plan.hasMigration(migrationRecreateStatefulSets) {
+		return
 	}
+	j.Step("recreate-statefulsets", func() {
+		for _, statefulSet := range statefulSetsToDelete {
+			err := client.GetClientset().AppsV1().StatefulSets("runai").Delete(statefulSet, &metav1.DeleteOptions{})
+			if err == nil {
+				log.Debugf("Deleted Statefulset: %v", statefulSet)
+			}
+		}
 
-	kubectl.Apply(file.Name())
+		for _, pvc := range pvcsToDelete {
+			err := client.GetClientset().CoreV1().PersistentVolumeClaims("runai").Delete(pvc, &metav1.DeleteOptions{})
+			if err == nil {
+				log.Debugf("Deleted PVC: %v", pvc)
+			}
+		}
+	})
 }
 
-func upgradeVersion(client *client.Client, upgradeFlags upgradeFlags) {
+func setOperatorImage(client *client.Client, image string, j *journal.Journal) {
 	var err error
 	var deployment *appsv1.Deployment
-	shouldDeleteStsAndPvc := false
 	for i := 0; i < common.NumberOfRetiresForApiServer; i++ {
 		deployment, err = client.GetClientset().AppsV1().Deployments("runai").Get("runai-operator", metav1.GetOptions{})
 		if err != nil {
 			log.Infof("Run:AI operator does not exist on runai namespace, error: %v", err)
-			os.Exit(1)
-		}
-		currentImage := strings.Split(deployment.Spec.Template.Spec.Containers[0].Image, ":")
-		currentTag := currentImage[1]
-		if currentTag == "latest" {
-			if upgradeFlags.operatorVersion != "latest" {
-				log.Infof("Setting image to 'latest' as an old image was 'latest'")
-			}
-		} else {
-			if upgradeFlags.image != "" {
-				deployment.Spec.Template.Spec.Containers[0].Image = upgradeFlags.image
-				shouldDeleteStsAndPvc = true
-			} else {
-				currentMinorVersion := strings.Split(currentTag, ".")
-				currentMinorInt, _ := strconv.Atoi(currentMinorVersion[2])
-				deployment.Spec.Template.Spec.Containers[0].Image = fmt.Sprintf("%s:%s", currentImage[0], upgradeFlags.operatorVersion)
-				shouldDeleteStsAndPvc = currentMinorInt <= 92
-			}
+			journal.Exit()
 		}
+		j.RecordDeploymentTemplate(deployment)
+		deployment.Spec.Template.Spec.Containers[0].Image = image
 		_, err = client.GetClientset().AppsV1().Deployments("runai").Update(deployment)
 		if err != nil {
 			log.Debugf("Failed to update the deployment of the Run:AI operator, attempt: %v, error: %v", i, err)
@@ -140,38 +271,6 @@ func upgradeVersion(client *client.Client, upgradeFlags upgradeFlags) {
 	}
 	if err != nil {
 		log.Infof("Failed to update Run:AI operator with new tag, error: %v", err)
-		os.Exit(1)
-	}
-
-	if shouldDeleteStsAndPvc {
-		err = client.GetClientset().AppsV1().StatefulSets("runai").Delete("runai-db", &metav1.DeleteOptions{})
-		if err == nil {
-			log.Debugf("Deleted Statefulset: runai-db")
-		}
-
-		err = client.GetClientset().AppsV1().StatefulSets("runai").Delete("runai-prometheus-pushgateway", &metav1.DeleteOptions{})
-		if err == nil {
-			log.Debugf("Deleted Statefulset: runai-prometheus-pushgateway")
-		}
-
-		err = client.GetClientset().AppsV1().StatefulSets("runai").Delete("prometheus-runai-prometheus-operator-prometheus", &metav1.DeleteOptions{})
-		if err == nil {
-			log.Debugf("Deleted Statefulset: prometheus-runai-prometheus-operator-prometheus")
-		}
-
-		err = client.GetClientset().CoreV1().PersistentVolumeClaims("runai").Delete("data-runai-db-0", &metav1.DeleteOptions{})
-		if err == nil {
-			log.Debugf("Deleted PVC: data-runai-db-0")
-		}
-
-		err = client.GetClientset().CoreV1().PersistentVolumeClaims("runai").Delete("prometheus-runai-prometheus-operator-prometheus-db-prometheus-runai-prometheus-operator-prometheus-0", &metav1.DeleteOptions{})
-		if err == nil {
-			log.Debugf("Deleted PVC: prometheus-runai-prometheus-operator-prometheus-db-prometheus-runai-prometheus-operator-prometheus-0")
-		}
-
-		err = client.GetClientset().CoreV1().PersistentVolumeClaims("runai").Delete("storage-volume-runai-prometheus-pushgateway-0", &metav1.DeleteOptions{})
-		if err == nil {
-			log.Debugf("Deleted PVC: storage-volume-runai-prometheus-pushgateway-0")
-		}
+		journal.Exit()
 	}
 }
@@ -3,9 +3,9 @@ package version
 import (
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/run-ai/runai-cli/pkg/client"
+	"github.com/run-ai/runai-cli/pkg/image"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -21,8 +21,12 @@ func GetVersion() *cobra.Command {
 				fmt.Println("Run:AI is not running on the cluster")
 				os.Exit(1)
 			}
-			currentImage := strings.Split(deployment.Spec.Template.Spec.Containers[0].Image, ":")
-			fmt.Printf("Run:AI version: %v\n", currentImage[1])
+			currentImage, err := image.ParseReference(deployment.Spec.Template.Spec.Containers[0].Image)
+			if err != nil {
+				fmt.Printf("Failed to parse the Run:AI operator image, error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Run:AI version: %v\n", currentImage.Tag)
 		},
 	}
 
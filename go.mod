@@ -28,6 +28,7 @@ require (
 	k8s.io/cli-runtime v0.17.4
 	k8s.io/client-go v11.0.0+incompatible
 	k8s.io/kubectl v0.17.4
+	sigs.k8s.io/yaml v1.1.0
 )
 
 replace (
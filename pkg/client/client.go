@@ -21,6 +21,7 @@ type Client struct {
 	restConfig    *restclient.Config
 	dynamicClient dynamic.Interface
 	namespace     string
+	context       string
 }
 
 func GetClient() *Client {
@@ -57,8 +58,14 @@ func GetClient() *Client {
 		os.Exit(1)
 	}
 
+	context := ""
+	if rawConfig, err := clientConfig.RawConfig(); err == nil {
+		context = rawConfig.CurrentContext
+	}
+
 	return &Client{
 		namespace:     namespace,
+		context:       context,
 		restConfig:    restConfig,
 		clientset:     clientset,
 		dynamicClient: dynamicClient,
@@ -77,6 +84,10 @@ func (c *Client) GetRestConfig() *restclient.Config {
 	return c.restConfig
 }
 
+func (c *Client) GetCurrentContext() string {
+	return c.context
+}
+
 func (c *Client) GetDefaultNamespace() string {
 	return c.namespace
 }
@@ -0,0 +1,74 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reference is a parsed container image reference: [registry/]repository[:tag][@digest]
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference. The first path component is treated as the registry
+// when it contains a "." or a ":" (e.g. a port) or is "localhost", the same way docker does.
+func ParseReference(image string) (Reference, error) {
+	ref := Reference{}
+	remainder := strings.TrimSpace(image)
+	if remainder == "" {
+		return Reference{}, fmt.Errorf("empty image reference")
+	}
+
+	if i := strings.Index(remainder, "@"); i >= 0 {
+		ref.Digest = remainder[i+1:]
+		remainder = remainder[:i]
+	}
+
+	if i := strings.Index(remainder, "/"); i >= 0 {
+		firstComponent := remainder[:i]
+		if strings.ContainsAny(firstComponent, ".:") || firstComponent == "localhost" {
+			ref.Registry = firstComponent
+			remainder = remainder[i+1:]
+		}
+	}
+
+	if i := strings.LastIndex(remainder, ":"); i >= 0 {
+		ref.Tag = remainder[i+1:]
+		remainder = remainder[:i]
+	}
+
+	if remainder == "" || strings.Contains(remainder, ":") {
+		return Reference{}, fmt.Errorf("invalid image reference %q", image)
+	}
+	ref.Repository = remainder
+	return ref, nil
+}
+
+// Name returns the image without its tag and digest
+func (r Reference) Name() string {
+	if r.Registry == "" {
+		return r.Repository
+	}
+	return r.Registry + "/" + r.Repository
+}
+
+// WithTag returns the reference pointing to another tag, dropping the digest
+func (r Reference) WithTag(tag string) Reference {
+	r.Tag = tag
+	r.Digest = ""
+	return r
+}
+
+func (r Reference) String() string {
+	image := r.Name()
+	if r.Tag != "" {
+		image += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		image += "@" + r.Digest
+	}
+	return image
+}
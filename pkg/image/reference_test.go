@@ -0,0 +1,75 @@
+package image
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:4b1a5ce5a8c9d1b3e0e8f3c1f1d7a3b4e5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0"
+
+	tests := []struct {
+		image    string
+		expected Reference
+		wantErr  bool
+	}{
+		{
+			image:    "registry:5000/repo/img:1.0.45",
+			expected: Reference{Registry: "registry:5000", Repository: "repo/img", Tag: "1.0.45"},
+		},
+		{
+			image:    "gcr.io/run-ai-prod/operator:2.3.0-rc.1",
+			expected: Reference{Registry: "gcr.io", Repository: "run-ai-prod/operator", Tag: "2.3.0-rc.1"},
+		},
+		{
+			image:    "localhost/img:v2.1",
+			expected: Reference{Registry: "localhost", Repository: "img", Tag: "v2.1"},
+		},
+		{
+			image:    "runai/operator:1.0.45",
+			expected: Reference{Repository: "runai/operator", Tag: "1.0.45"},
+		},
+		{
+			image:    "img@" + digest,
+			expected: Reference{Repository: "img", Digest: digest},
+		},
+		{
+			image:    "img:1.0.45@" + digest,
+			expected: Reference{Repository: "img", Tag: "1.0.45", Digest: digest},
+		},
+		{
+			image:    "registry:5000/img",
+			expected: Reference{Registry: "registry:5000", Repository: "img"},
+		},
+		{
+			image:    "img",
+			expected: Reference{Repository: "img"},
+		},
+		{image: "", wantErr: true},
+		{image: "  ", wantErr: true},
+		{image: ":1.0.45", wantErr: true},
+		{image: "@" + digest, wantErr: true},
+		{image: "img:1:2", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			ref, err := ParseReference(test.image)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseReference() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if ref != test.expected {
+				t.Errorf("ParseReference() = %+v, expected %+v", ref, test.expected)
+			}
+			if !test.wantErr && ref.String() != test.image {
+				t.Errorf("String() = %q, expected %q", ref.String(), test.image)
+			}
+		})
+	}
+}
+
+func TestWithTag(t *testing.T) {
+	ref, err := ParseReference("registry:5000/repo/img:1.0.45@sha256:abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image := ref.WithTag("1.0.46").String(); image != "registry:5000/repo/img:1.0.46" {
+		t.Errorf("WithTag() = %q, expected %q", image, "registry:5000/repo/img:1.0.46")
+	}
+}
@@ -0,0 +1,185 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	FieldManager = "runai-adm"
+
+	crdEstablishedTimeout  = 60 * time.Second
+	crdEstablishedInterval = time.Second
+)
+
+// ApplyFile applies every object of a multi-document YAML file
+func ApplyFile(client *client.Client, filePath string) error {
+	objects, err := ReadManifestFile(filePath)
+	if err != nil {
+		return err
+	}
+	return Apply(client, objects)
+}
+
+// ApplyYaml applies every object of a multi-document YAML string
+func ApplyYaml(client *client.Client, data string) error {
+	objects, err := ParseManifests([]byte(data))
+	if err != nil {
+		return err
+	}
+	return Apply(client, objects)
+}
+
+// Apply applies the objects with server-side apply. Namespaces and CRDs are applied first and
+// the CRDs are waited on to become Established, so custom resources in the same manifest can be created.
+// Every object is attempted and the returned error aggregates all per-object failures.
+func Apply(client *client.Client, objects []*unstructured.Unstructured) error {
+	mapper := getResourceMapper(client)
+	first, rest := splitByApplyOrder(objects)
+
+	var errs []error
+	var appliedCrds []*unstructured.Unstructured
+	for _, obj := range first {
+		if err := applyObject(mapper, obj); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if isCrd(obj) {
+			appliedCrds = append(appliedCrds, obj)
+		}
+	}
+
+	for _, crd := range appliedCrds {
+		if err := waitForCrdEstablished(mapper, crd); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(appliedCrds) > 0 {
+		mapper.reset()
+	}
+
+	for _, obj := range rest {
+		if err := applyObject(mapper, obj); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// ObjectRef returns a kubectl like reference of the object, e.g. "ClusterRole/runai" or "Deployment/runai/runai-operator"
+func ObjectRef(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())
+	}
+	return fmt.Sprintf("%s/%s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+}
+
+func splitByApplyOrder(objects []*unstructured.Unstructured) (first, rest []*unstructured.Unstructured) {
+	var crds []*unstructured.Unstructured
+	for _, obj := range objects {
+		switch {
+		case isNamespace(obj):
+			first = append(first, obj)
+		case isCrd(obj):
+			crds = append(crds, obj)
+		default:
+			rest = append(rest, obj)
+		}
+	}
+	return append(first, crds...), rest
+}
+
+func isNamespace(obj *unstructured.Unstructured) bool {
+	return obj.GetKind() == "Namespace" && obj.GroupVersionKind().Group == ""
+}
+
+func isCrd(obj *unstructured.Unstructured) bool {
+	return obj.GetKind() == "CustomResourceDefinition" && obj.GroupVersionKind().Group == "apiextensions.k8s.io"
+}
+
+func applyObject(mapper *resourceMapper, obj *unstructured.Unstructured) error {
+	ref := ObjectRef(obj)
+	mapping, err := mapper.mappingForObject(obj)
+	if err != nil {
+		log.Errorf("%s failed: %v", ref, err)
+		return fmt.Errorf("%s: %v", ref, err)
+	}
+	resource := mapper.resourceInterface(mapping, obj.GetNamespace())
+
+	oldResourceVersion := ""
+	existing, err := resource.Get(obj.GetName(), metav1.GetOptions{})
+	if err == nil {
+		oldResourceVersion = existing.GetResourceVersion()
+	} else if !apierrors.IsNotFound(err) {
+		log.Errorf("%s failed: %v", ref, err)
+		return fmt.Errorf("%s: %v", ref, err)
+	}
+
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return fmt.Errorf("%s: %v", ref, err)
+	}
+	force := true
+	applied, err := resource.Patch(obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: FieldManager, Force: &force})
+	if err != nil {
+		log.Errorf("%s failed: %v", ref, err)
+		return fmt.Errorf("%s: %v", ref, err)
+	}
+
+	switch {
+	case oldResourceVersion == "":
+		log.Debugf("%s created", ref)
+	case oldResourceVersion == applied.GetResourceVersion():
+		log.Debugf("%s unchanged", ref)
+	default:
+		log.Debugf("%s configured", ref)
+	}
+	return nil
+}
+
+func waitForCrdEstablished(mapper *resourceMapper, crd *unstructured.Unstructured) error {
+	mapping, err := mapper.mappingForObject(crd)
+	if err != nil {
+		return err
+	}
+	resource := mapper.resourceInterface(mapping, "")
+
+	log.Debugf("Waiting for CRD %s to be established", crd.GetName())
+	err = wait.PollImmediate(crdEstablishedInterval, crdEstablishedTimeout, func() (bool, error) {
+		current, err := resource.Get(crd.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		return isCrdEstablished(current), nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: was not established after %v", ObjectRef(crd), crdEstablishedTimeout)
+	}
+	return nil
+}
+
+func isCrdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if conditionMap["type"] == "Established" && strings.EqualFold(fmt.Sprint(conditionMap["status"]), "True") {
+			return true
+		}
+	}
+	return false
+}
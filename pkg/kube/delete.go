@@ -0,0 +1,76 @@
+package kube
+
+import (
+	"fmt"
+
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+)
+
+// DeleteResult is the outcome of deleting a single object
+type DeleteResult struct {
+	Ref      string
+	NotFound bool
+	Err      error
+}
+
+// Delete deletes the named objects of a resource. The resource may be given the way kubectl
+// accepts it (e.g. "psp", "clusterrole", "mutatingwebhookconfigurations.admissionregistration.k8s.io").
+// Objects that do not exist are reported as NotFound and are not an error.
+func Delete(client *client.Client, resource, namespace string, names ...string) ([]DeleteResult, error) {
+	mapper := getResourceMapper(client)
+	mapping, err := mapper.mappingForResource(resource)
+	if err != nil {
+		log.Debugf("Skipping delete of %s: %v", resource, err)
+		return nil, err
+	}
+	return deleteNames(mapper.resourceInterface(mapping, namespace), mapping.GroupVersionKind.Kind, names)
+}
+
+func deleteNames(resourceInterface dynamic.ResourceInterface, kind string, names []string) ([]DeleteResult, error) {
+	var results []DeleteResult
+	var errs []error
+	for _, name := range names {
+		result := DeleteResult{Ref: fmt.Sprintf("%s/%s", kind, name)}
+		err := resourceInterface.Delete(name, &metav1.DeleteOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			result.NotFound = true
+		case err != nil:
+			log.Debugf("Failed to delete %s: %v", result.Ref, err)
+			result.Err = err
+			errs = append(errs, fmt.Errorf("%s: %v", result.Ref, err))
+		default:
+			log.Debugf("Deleted %s", result.Ref)
+		}
+		results = append(results, result)
+	}
+	return results, utilerrors.NewAggregate(errs)
+}
+
+// DeleteAll deletes every object of a resource in the namespace
+func DeleteAll(client *client.Client, resource, namespace string) ([]DeleteResult, error) {
+	mapper := getResourceMapper(client)
+	mapping, err := mapper.mappingForResource(resource)
+	if err != nil {
+		log.Debugf("Skipping delete of %s: %v", resource, err)
+		return nil, err
+	}
+	resourceInterface := mapper.resourceInterface(mapping, namespace)
+
+	list, err := resourceInterface.List(metav1.ListOptions{})
+	if err != nil {
+		log.Debugf("Failed to list %s: %v", mapping.Resource.Resource, err)
+		return nil, err
+	}
+
+	var names []string
+	for _, item := range list.Items {
+		names = append(names, item.GetName())
+	}
+	return deleteNames(resourceInterface, mapping.GroupVersionKind.Kind, names)
+}
@@ -0,0 +1,218 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/run-ai/runai-cli/pkg/client"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type DiffAction string
+
+const (
+	DiffCreate    DiffAction = "create"
+	DiffUpdate    DiffAction = "update"
+	DiffUnchanged DiffAction = "unchanged"
+	DiffError     DiffAction = "error"
+)
+
+// fields that are maintained by the server and would show up as noise in every diff
+var ignoredDiffFields = []string{
+	"metadata.managedFields",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.creationTimestamp",
+	"metadata.uid",
+	"metadata.selfLink",
+	"metadata.annotations.kubectl.kubernetes.io/last-applied-configuration",
+	"status",
+}
+
+type FieldChange struct {
+	Path     string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+type ObjectDiff struct {
+	Ref     string
+	Action  DiffAction
+	Message string
+	Changes []FieldChange
+}
+
+// Diff computes what applying the objects would change, using a server-side dry-run apply so that
+// defaulting and merging are done by the API server exactly as in a real apply
+func Diff(client *client.Client, objects []*unstructured.Unstructured) []ObjectDiff {
+	mapper := getResourceMapper(client)
+	first, rest := splitByApplyOrder(objects)
+
+	var diffs []ObjectDiff
+	for _, obj := range append(first, rest...) {
+		diffs = append(diffs, diffObject(mapper, obj))
+	}
+	return diffs
+}
+
+func diffObject(mapper *resourceMapper, obj *unstructured.Unstructured) ObjectDiff {
+	diff := ObjectDiff{Ref: ObjectRef(obj)}
+	mapping, err := mapper.mappingForObject(obj)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			diff.Action = DiffCreate
+			diff.Message = "resource type is not installed yet"
+			return diff
+		}
+		diff.Action = DiffError
+		diff.Message = err.Error()
+		return diff
+	}
+	resource := mapper.resourceInterface(mapping, obj.GetNamespace())
+
+	existing, err := resource.Get(obj.GetName(), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		diff.Action = DiffError
+		diff.Message = err.Error()
+		return diff
+	}
+	if apierrors.IsNotFound(err) {
+		diff.Action = DiffCreate
+		return diff
+	}
+
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		diff.Action = DiffError
+		diff.Message = err.Error()
+		return diff
+	}
+	force := true
+	applied, err := resource.Patch(obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: FieldManager,
+		Force:        &force,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+	if err != nil {
+		diff.Action = DiffError
+		diff.Message = err.Error()
+		return diff
+	}
+
+	diff.Changes = DiffFields(existing.Object, applied.Object)
+	diff.Action = DiffUnchanged
+	if len(diff.Changes) > 0 {
+		diff.Action = DiffUpdate
+	}
+	return diff
+}
+
+// DiffFields returns the leaf fields that differ between two objects, ignoring server maintained fields
+func DiffFields(oldObject, newObject map[string]interface{}) []FieldChange {
+	oldFields := map[string]interface{}{}
+	newFields := map[string]interface{}{}
+	flattenFields("", oldObject, oldFields)
+	flattenFields("", newObject, newFields)
+
+	paths := map[string]bool{}
+	for path := range oldFields {
+		paths[path] = true
+	}
+	for path := range newFields {
+		paths[path] = true
+	}
+
+	var changes []FieldChange
+	for path := range paths {
+		if isIgnoredDiffField(path) {
+			continue
+		}
+		oldValue, oldFound := oldFields[path]
+		newValue, newFound := newFields[path]
+		if oldFound && newFound && fmt.Sprint(oldValue) == fmt.Sprint(newValue) {
+			continue
+		}
+		changes = append(changes, FieldChange{Path: path, OldValue: oldValue, NewValue: newValue})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func flattenFields(prefix string, value interface{}, out map[string]interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if len(typed) == 0 && prefix != "" {
+			out[prefix] = typed
+		}
+		for key, child := range typed {
+			flattenFields(joinFieldPath(prefix, key), child, out)
+		}
+	case []interface{}:
+		if len(typed) == 0 {
+			out[prefix] = typed
+		}
+		for i, child := range typed {
+			flattenFields(fmt.Sprintf("%s[%d]", prefix, i), child, out)
+		}
+	default:
+		out[prefix] = typed
+	}
+}
+
+func joinFieldPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func isIgnoredDiffField(path string) bool {
+	for _, ignored := range ignoredDiffFields {
+		if path == ignored || strings.HasPrefix(path, ignored+".") || strings.HasPrefix(path, ignored+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintDiffs writes the diffs under a title, skipping objects that would not change
+func PrintDiffs(w io.Writer, title string, diffs []ObjectDiff) {
+	fmt.Fprintf(w, "=== %s\n", title)
+	unchanged := 0
+	for _, diff := range diffs {
+		if diff.Action == DiffUnchanged {
+			unchanged++
+			continue
+		}
+		if diff.Message != "" {
+			fmt.Fprintf(w, "%s %s (%s)\n", diff.Action, diff.Ref, diff.Message)
+		} else {
+			fmt.Fprintf(w, "%s %s\n", diff.Action, diff.Ref)
+		}
+		PrintFieldChanges(w, diff.Changes)
+	}
+	fmt.Fprintf(w, "%d objects unchanged\n\n", unchanged)
+}
+
+// PrintFieldChanges writes one line per changed field, "+" for added, "-" for removed and "~" for modified fields
+func PrintFieldChanges(w io.Writer, changes []FieldChange) {
+	for _, change := range changes {
+		switch {
+		case change.OldValue == nil:
+			fmt.Fprintf(w, "    + %s: %v\n", change.Path, change.NewValue)
+		case change.NewValue == nil:
+			fmt.Fprintf(w, "    - %s: %v\n", change.Path, change.OldValue)
+		default:
+			fmt.Fprintf(w, "    ~ %s: %v -> %v\n", change.Path, change.OldValue, change.NewValue)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package kube
+
+import (
+	"io"
+
+	"github.com/run-ai/runai-cli/pkg/client"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Exec runs a command in a container of a pod through the pods/exec API
+func Exec(client *client.Client, namespace, pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	request := client.GetClientset().CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(client.GetRestConfig(), "POST", request.URL())
+	if err != nil {
+		return err
+	}
+	return executor.Stream(remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+}
@@ -0,0 +1,25 @@
+package kube
+
+import (
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// removes all the finalizers of an object without conflicting with concurrent updates of other fields
+var clearFinalizersPatch = []byte(`{"metadata":{"finalizers":null}}`)
+
+// ClearFinalizers removes the finalizers of an object so that its deletion completes without waiting for the
+// controllers that own the finalizers. Whatever cleanup those controllers would have done is skipped.
+func ClearFinalizers(client *client.Client, obj *Object) error {
+	if len(obj.GetFinalizers()) == 0 {
+		return nil
+	}
+	_, err := client.GetDynamicClient().Resource(obj.Resource).Namespace(obj.GetNamespace()).Patch(obj.GetName(), types.MergePatchType, clearFinalizersPatch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	log.Debugf("Cleared finalizers %v of %s", obj.GetFinalizers(), obj.Ref())
+	return nil
+}
@@ -0,0 +1,123 @@
+package kube
+
+import (
+	"strings"
+
+	"github.com/run-ai/runai-cli/pkg/client"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// cluster scoped resources that are never part of an installation
+var excludedClusterResources = map[string]bool{
+	"nodes":             true,
+	"namespaces":        true,
+	"componentstatuses": true,
+	"csinodes":          true,
+}
+
+// Object is a listed object together with the resource that serves it
+type Object struct {
+	Resource schema.GroupVersionResource
+	unstructured.Unstructured
+}
+
+func (o *Object) Ref() string {
+	return ObjectRef(&o.Unstructured)
+}
+
+// ListClusterScoped lists the objects that match of every cluster scoped resource found by API discovery
+// that can be listed and deleted. Resources that fail to be listed are reported in the returned error
+// while the objects of all other resources are still returned.
+func ListClusterScoped(client *client.Client, match func(obj *unstructured.Unstructured) bool) ([]Object, error) {
+	return listDiscovered(client, false, "", match)
+}
+
+// ListNamespaced lists the objects that match of every namespaced resource found by API discovery in a namespace,
+// reporting resources that fail to be listed the same way as ListClusterScoped
+func ListNamespaced(client *client.Client, namespace string, match func(obj *unstructured.Unstructured) bool) ([]Object, error) {
+	return listDiscovered(client, true, namespace, match)
+}
+
+func listDiscovered(client *client.Client, namespaced bool, namespace string, match func(obj *unstructured.Unstructured) bool) ([]Object, error) {
+	resourceLists, err := client.GetClientset().Discovery().ServerPreferredResources()
+	var errs []error
+	if err != nil {
+		// discovery of some groups (e.g. an unavailable APIService) failed, continue with the groups that were found
+		log.Debugf("Partial API discovery: %v", err)
+		errs = append(errs, err)
+	}
+
+	var objects []Object
+	for _, resourceList := range resourceLists {
+		groupVersion, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, apiResource := range resourceList.APIResources {
+			if apiResource.Namespaced != namespaced || strings.Contains(apiResource.Name, "/") {
+				continue
+			}
+			if !namespaced && excludedClusterResources[apiResource.Name] {
+				continue
+			}
+			if !hasVerbs(apiResource, "list", "delete") {
+				continue
+			}
+			resource := groupVersion.WithResource(apiResource.Name)
+			list, err := client.GetDynamicClient().Resource(resource).Namespace(namespace).List(metav1.ListOptions{})
+			if err != nil {
+				log.Debugf("Failed to list %s: %v", resource.String(), err)
+				errs = append(errs, err)
+				continue
+			}
+			for _, item := range list.Items {
+				if match(&item) {
+					objects = append(objects, Object{Resource: resource, Unstructured: item})
+				}
+			}
+		}
+	}
+	return objects, utilerrors.NewAggregate(errs)
+}
+
+// NewObject returns a reference to an object that can be passed to GetObject, DeleteObject and ClearFinalizers
+func NewObject(resource schema.GroupVersionResource, namespace, name string) *Object {
+	obj := &Object{Resource: resource}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+// GetObject gets the current state of a listed object
+func GetObject(client *client.Client, obj *Object) (*Object, error) {
+	current, err := client.GetDynamicClient().Resource(obj.Resource).Namespace(obj.GetNamespace()).Get(obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &Object{Resource: obj.Resource, Unstructured: *current}, nil
+}
+
+// DeleteObject deletes a listed object
+func DeleteObject(client *client.Client, obj *Object) error {
+	return client.GetDynamicClient().Resource(obj.Resource).Namespace(obj.GetNamespace()).Delete(obj.GetName(), &metav1.DeleteOptions{})
+}
+
+func hasVerbs(apiResource metav1.APIResource, verbs ...string) bool {
+	for _, verb := range verbs {
+		found := false
+		for _, supported := range apiResource.Verbs {
+			if supported == verb {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package kube
+
+import (
+	"github.com/run-ai/runai-cli/pkg/client"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+// List lists the objects of a resource given the way kubectl accepts it (e.g. "projects", "cm").
+// An empty namespace lists all namespaces, the namespace is ignored for cluster scoped resources.
+func List(client *client.Client, resource, namespace, labelSelector string) ([]Object, error) {
+	mapper := getResourceMapper(client)
+	mapping, err := mapper.mappingForResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	var resourceInterface dynamic.ResourceInterface = client.GetDynamicClient().Resource(mapping.Resource)
+	if namespace != "" {
+		resourceInterface = mapper.resourceInterface(mapping, namespace)
+	}
+	list, err := resourceInterface.List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	var objects []Object
+	for _, item := range list.Items {
+		objects = append(objects, Object{Resource: mapping.Resource, Unstructured: item})
+	}
+	return objects, nil
+}
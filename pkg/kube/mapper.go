@@ -0,0 +1,84 @@
+package kube
+
+import (
+	"fmt"
+
+	"github.com/run-ai/runai-cli/pkg/client"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// resourceMapper resolves kinds and kubectl style resource names (e.g. "psp", "crd")
+// to the resources served by the cluster, the same way kubectl does.
+type resourceMapper struct {
+	client   *client.Client
+	deferred *restmapper.DeferredDiscoveryRESTMapper
+	mapper   meta.RESTMapper
+}
+
+var resourceMappers = map[*client.Client]*resourceMapper{}
+
+// getResourceMapper returns a mapper for the client, discovery results are shared between calls
+func getResourceMapper(client *client.Client) *resourceMapper {
+	if mapper, found := resourceMappers[client]; found {
+		return mapper
+	}
+	mapper := newResourceMapper(client)
+	resourceMappers[client] = mapper
+	return mapper
+}
+
+func newResourceMapper(client *client.Client) *resourceMapper {
+	discoveryClient := client.GetClientset().Discovery()
+	deferred := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	return &resourceMapper{
+		client:   client,
+		deferred: deferred,
+		mapper:   restmapper.NewShortcutExpander(deferred, discoveryClient),
+	}
+}
+
+// reset drops the cached discovery information, needed after new CRDs were created
+func (m *resourceMapper) reset() {
+	m.deferred.Reset()
+}
+
+func (m *resourceMapper) mappingForObject(obj *unstructured.Unstructured) (*meta.RESTMapping, error) {
+	gvk := obj.GroupVersionKind()
+	return m.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+// mappingForResource resolves a resource argument such as "clusterrole", "pc" or
+// "mutatingwebhookconfigurations.admissionregistration.k8s.io"
+func (m *resourceMapper) mappingForResource(resource string) (*meta.RESTMapping, error) {
+	gvr, err := m.mapper.ResourceFor(schema.ParseGroupResource(resource).WithVersion(""))
+	if meta.IsNoMatchError(err) {
+		// kept as is so that callers can tell a resource type that is not installed from other failures
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find resource %s: %v", resource, err)
+	}
+	gvk, err := m.mapper.KindFor(gvr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find kind of resource %s: %v", resource, err)
+	}
+	return m.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+// resourceInterface returns the dynamic client for the mapping, scoped to the namespace
+// when the resource is namespaced
+func (m *resourceMapper) resourceInterface(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	resource := m.client.GetDynamicClient().Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if namespace == "" {
+			namespace = m.client.GetDefaultNamespace()
+		}
+		return resource.Namespace(namespace)
+	}
+	return resource
+}
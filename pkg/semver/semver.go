@@ -0,0 +1,131 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version as used in Run:AI image tags, e.g. "1.0.45", "v2.1" or "2.3.0-rc.1"
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	PreRelease string
+}
+
+// Parse parses a version, allowing a leading "v" and a missing patch (or minor) component
+func Parse(version string) (Version, error) {
+	v := Version{}
+	trimmed := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.Index(trimmed, "+"); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+	if i := strings.Index(trimmed, "-"); i >= 0 {
+		v.PreRelease = trimmed[i+1:]
+		trimmed = trimmed[:i]
+	}
+
+	parts := strings.Split(trimmed, ".")
+	if len(parts) == 0 || len(parts) > 3 || parts[0] == "" {
+		return Version{}, fmt.Errorf("invalid version %q", version)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", version)
+		}
+		*numbers[i] = number
+	}
+	return v, nil
+}
+
+// MustParse parses a version and panics when it is invalid, for use with constant versions
+func MustParse(version string) Version {
+	v, err := Parse(version)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Compare returns -1, 0 or 1 when v is lower, equal or greater than other.
+// A pre-release is lower than the release with the same major, minor and patch, pre-releases are compared by their
+// dot-separated identifiers as in SemVer.
+func (v Version) Compare(other Version) int {
+	for _, diff := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if diff < 0 {
+			return -1
+		}
+		if diff > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.PreRelease == other.PreRelease:
+		return 0
+	case v.PreRelease == "":
+		return 1
+	case other.PreRelease == "":
+		return -1
+	default:
+		return comparePreRelease(v.PreRelease, other.PreRelease)
+	}
+}
+
+// comparePreRelease compares the identifiers one by one: numeric identifiers numerically and lower than alphanumeric
+// ones, the others as strings. When all the identifiers are equal the pre-release with more identifiers is greater.
+func comparePreRelease(preRelease, other string) int {
+	identifiers, otherIdentifiers := strings.Split(preRelease, "."), strings.Split(other, ".")
+	for i := 0; i < len(identifiers) && i < len(otherIdentifiers); i++ {
+		if result := compareIdentifier(identifiers[i], otherIdentifiers[i]); result != 0 {
+			return result
+		}
+	}
+	return compareInts(len(identifiers), len(otherIdentifiers))
+}
+
+func compareIdentifier(identifier, other string) int {
+	number, err := strconv.ParseUint(identifier, 10, 64)
+	numeric := err == nil
+	otherNumber, err := strconv.ParseUint(other, 10, 64)
+	otherNumeric := err == nil
+	switch {
+	case numeric && otherNumeric:
+		switch {
+		case number < otherNumber:
+			return -1
+		case number > otherNumber:
+			return 1
+		}
+		return 0
+	case numeric:
+		return -1
+	case otherNumeric:
+		return 1
+	}
+	return strings.Compare(identifier, other)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (v Version) LessThan(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+func (v Version) String() string {
+	version := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		version += "-" + v.PreRelease
+	}
+	return version
+}
@@ -0,0 +1,84 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected Version
+		wantErr  bool
+	}{
+		{version: "1.0.45", expected: Version{Major: 1, Minor: 0, Patch: 45}},
+		{version: "v2.1", expected: Version{Major: 2, Minor: 1}},
+		{version: "3", expected: Version{Major: 3}},
+		{version: " 2.3.0-rc.1 ", expected: Version{Major: 2, Minor: 3, PreRelease: "rc.1"}},
+		{version: "2.3.0-rc.1+build.5", expected: Version{Major: 2, Minor: 3, PreRelease: "rc.1"}},
+		{version: "", wantErr: true},
+		{version: "1.2.3.4", wantErr: true},
+		{version: "1.x", wantErr: true},
+		{version: "1.-2", wantErr: true},
+		{version: "latest", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			v, err := Parse(test.version)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if v != test.expected {
+				t.Errorf("Parse() = %+v, expected %+v", v, test.expected)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		v        string
+		other    string
+		expected int
+	}{
+		{v: "1.0.45", other: "1.0.45", expected: 0},
+		{v: "v1.0", other: "1.0.0", expected: 0},
+		{v: "1.0.45", other: "1.0.46", expected: -1},
+		{v: "1.10.0", other: "1.9.0", expected: 1},
+		{v: "2.0.0", other: "1.99.99", expected: 1},
+		{v: "2.3.0-rc.1", other: "2.3.0", expected: -1},
+		{v: "2.3.0", other: "2.3.0-rc.1", expected: 1},
+		{v: "2.3.0-rc.10", other: "2.3.0-rc.9", expected: 1},
+		{v: "2.3.0-rc.9", other: "2.3.0-rc.10", expected: -1},
+		{v: "2.3.0-alpha", other: "2.3.0-beta", expected: -1},
+		{v: "2.3.0-alpha", other: "2.3.0-alpha.1", expected: -1},
+		{v: "2.3.0-alpha.1", other: "2.3.0-alpha.beta", expected: -1},
+		{v: "2.3.0-beta.11", other: "2.3.0-beta.2", expected: 1},
+		{v: "2.3.0-1", other: "2.3.0-rc", expected: -1},
+		{v: "2.3.0-rc.1", other: "2.3.0-rc.1+build.2", expected: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.v+" "+test.other, func(t *testing.T) {
+			if result := MustParse(test.v).Compare(MustParse(test.other)); result != test.expected {
+				t.Errorf("Compare() = %d, expected %d", result, test.expected)
+			}
+			if result := MustParse(test.other).Compare(MustParse(test.v)); result != -test.expected {
+				t.Errorf("reversed Compare() = %d, expected %d", result, -test.expected)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{version: "v2.1", expected: "2.1.0"},
+		{version: "2.3.0-rc.1", expected: "2.3.0-rc.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			if s := MustParse(test.version).String(); s != test.expected {
+				t.Errorf("String() = %q, expected %q", s, test.expected)
+			}
+		})
+	}
+}